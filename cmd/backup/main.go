@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/lmittmann/tint"
+
+	"github.com/igorvan/scan-takehome/pkg/backup"
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// usage: backup [-dsn DSN] dump|restore FILE
+func main() {
+	dsn := flag.String("dsn", "processor:password@tcp(db:3306)/processor", "MySQL DSN")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] dump|restore FILE\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	command, path := flag.Arg(0), flag.Arg(1)
+
+	logger := slog.New(tint.NewHandler(os.Stdout, nil))
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		panic(err)
+	}
+	storage, err := database.New(db, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "dump":
+		f, err := os.Create(path)
+		if err != nil {
+			panic(err)
+		}
+		n, err := backup.Dump(ctx, storage, f)
+		if err == nil {
+			err = f.Close()
+		}
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(path)
+			logger.Error(fmt.Sprintf("backup has failed after %d records: %s", n, err))
+			os.Exit(1)
+		}
+		logger.Info(fmt.Sprintf("Backup has completed: %d records written to %s", n, path))
+	case "restore":
+		f, err := os.Open(path)
+		if err != nil {
+			panic(err)
+		}
+		defer func() { _ = f.Close() }()
+		stats, err := backup.Restore(ctx, f, storage)
+		if err != nil {
+			logger.Error(fmt.Sprintf("restore has failed after %d records: %s", stats.Read, err))
+			os.Exit(1)
+		}
+		logger.Info(fmt.Sprintf("Restore has completed: %d records read, %d written, %d skipped as stale",
+			stats.Read, stats.Written, stats.Skipped))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
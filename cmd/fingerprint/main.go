@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/lmittmann/tint"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/processing"
+)
+
+// re-fingerprints the stored records with the current rules, e.g. after new rules have been added,
+// records written meanwhile are fingerprinted by the processor
+func main() {
+	dsn := flag.String("dsn", "processor:password@tcp(db:3306)/processor", "MySQL DSN")
+	rulesPath := flag.String("fingerprints", "", "Fingerprint rules JSON file")
+	service := flag.String("service", "", "Only re-fingerprint records of the service, empty re-fingerprints every record")
+	batch := flag.Int("batch", processing.DefaultRefingerprintBatch, "Number of records read at once")
+	dryRun := flag.Bool("dry-run", false, "Only report the number of records which would be updated")
+	flag.Parse()
+
+	logger := slog.New(tint.NewHandler(os.Stdout, nil))
+	if *rulesPath == "" {
+		logger.Error("-fingerprints rule file is required")
+		os.Exit(2)
+	}
+	f, err := os.Open(*rulesPath)
+	if err != nil {
+		panic(err)
+	}
+	rules, err := processing.LoadFingerprintRules(f)
+	_ = f.Close()
+	if err != nil {
+		panic(fmt.Errorf("cannot load fingerprint rules %s: %w", *rulesPath, err))
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		panic(err)
+	}
+	storage, err := database.New(db, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	stats, err := processing.Refingerprint(context.Background(), storage, rules, processing.RefingerprintConfig{
+		Service:   *service,
+		BatchSize: *batch,
+		DryRun:    *dryRun,
+	})
+	summary := fmt.Sprintf("%d records read, %d fingerprinted, %d updated, %d skipped as rewritten meanwhile",
+		stats.Read, stats.Fingerprinted, stats.Updated, stats.Skipped)
+	if *dryRun {
+		summary = fmt.Sprintf("%d records read, %d fingerprinted, %d would be updated", stats.Read, stats.Fingerprinted, stats.Updated)
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Re-fingerprinting has failed: %s (%s)", err, summary))
+		os.Exit(1)
+	}
+	logger.Info(fmt.Sprintf("Re-fingerprinting has completed with %d rules: %s", rules.Len(), summary))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/lmittmann/tint"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// brings the schema of a database created by an older db_init/scan_results.sql up to date,
+// db_init only runs for an empty database, so existing ones have to be migrated before the new processor is rolled out
+func main() {
+	dsn := flag.String("dsn", "processor:password@tcp(db:3306)/processor", "MySQL DSN")
+	flag.Parse()
+
+	logger := slog.New(tint.NewHandler(os.Stdout, nil))
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		panic(err)
+	}
+	storage, err := database.New(db, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	applied, err := storage.Migrate(context.Background())
+	if err != nil {
+		logger.Error(fmt.Sprintf("Migration has failed after %d applied migrations: %s", len(applied), err))
+		os.Exit(1)
+	}
+	if len(applied) == 0 {
+		logger.Info("Schema is up to date")
+		return
+	}
+	logger.Info(fmt.Sprintf("Migration has completed: %s", strings.Join(applied, ", ")))
+}
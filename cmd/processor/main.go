@@ -1,20 +1,32 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/pubsub"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/lmittmann/tint"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/dualwrite"
+	"github.com/igorvan/scan-takehome/pkg/faults"
+	"github.com/igorvan/scan-takehome/pkg/metrics"
 	"github.com/igorvan/scan-takehome/pkg/processing"
 	"github.com/igorvan/scan-takehome/pkg/scanning"
 )
@@ -23,8 +35,46 @@ func main() {
 	projectID := flag.String("project", "test-project", "GCP Project ID")
 	topicID := flag.String("topic", "scan-topic", "GCP PubSub Topic ID")
 	subID := flag.String("subscription", "scan-sub", "GCP PubSub Subscription Name")
+	dsn := flag.String("dsn", "processor:password@tcp(db:3306)/processor", "MySQL DSN")
+	secondaryDSN := flag.String("secondary-dsn", "", "Secondary MySQL DSN, enables dual-write when set")
+	secondaryPolicy := flag.String("secondary-policy", "retry", "Secondary storage write failure policy: log, retry or fail")
+	faultsCfg := faults.Config{Seed: time.Now().UnixNano()}
+	flag.Float64Var(&faultsCfg.ErrorProbability, "fault-error", 0, "Probability of an injected storage error (resilience testing only)")
+	flag.Float64Var(&faultsCfg.TimeoutProbability, "fault-timeout", 0, "Probability of an injected storage timeout (resilience testing only)")
+	flag.Float64Var(&faultsCfg.CommittedErrorProbability, "fault-committed-error", 0, "Probability of a committed storage write reported as failed (resilience testing only)")
+	flag.Float64Var(&faultsCfg.LatencyProbability, "fault-latency", 0, "Probability of an injected storage latency (resilience testing only)")
+	flag.DurationVar(&faultsCfg.Latency, "fault-latency-duration", 500*time.Millisecond, "Injected storage latency")
+	validate := flag.Bool("validate", true, "Validate scans before storing them")
+	quarantine := flag.Bool("quarantine", true, "Keep scans failing validation in the quarantine table instead of dropping them")
+	maxSkew := flag.Duration("max-skew", 5*time.Minute, "Scans with timestamps beyond processing time plus this skew are handled by -skew-action, 0 disables the check")
+	skewAction := flag.String("skew-action", "quarantine", "What to do with scans from the future: reject, clamp or quarantine")
+	services := flag.String("services", "", "Comma-separated services to store, scans of other services are dropped, empty stores everything")
+	geoIP := flag.String("geoip", "", "GeoIP/ASN database CSV file (network,asn,org,country), enables enrichment when set")
+	geoIPReload := flag.Duration("geoip-reload", time.Minute, "How often the GeoIP database file is checked for changes, it's also reloaded on SIGHUP")
+	fingerprints := flag.String("fingerprints", "", "Fingerprint rules JSON file, enables product and version fingerprinting when set")
+	fingerprintsReload := flag.Duration("fingerprints-reload", time.Minute, "How often the fingerprint rules file is checked for changes, it's also reloaded on SIGHUP")
+	workers := flag.Int("workers", 16, "Number of storage workers, scans of the same record are always processed by the same worker")
+	queueSize := flag.Int("queue-size", 16, "Per-worker queue size, message delivery is slowed down when queues are full")
+	redact := flag.Bool("redact", true, "Redact cookies, authorization headers, credentials and API keys from scans before storing them")
+	var redactionRules []processing.RedactionRule
+	flag.Func("redact-rule", "Additional redaction rule name=regexp, only the capture group named secret is redacted if there is one (repeatable)",
+		func(s string) error {
+			rule, err := processing.ParseRedactionRule(s)
+			if err != nil {
+				return err
+			}
+			redactionRules = append(redactionRules, rule)
+			return nil
+		})
+	maxPayload := flag.Int64("max-payload", scanning.DefaultMaxPayload, "Maximum decompressed message size in bytes, larger messages are dropped")
+	expiry := flag.Duration("expiry", database.DefaultExpiry, "Records not seen for longer than this are reported as reappeared when seen again, 0 disables expiry")
+	metricsAddr := flag.String("metrics-addr", ":9090", "Prometheus metrics listen address, empty disables metrics")
+	flag.Parse()
 
-	ctx := context.Background()
+	// stops receiving on SIGINT/SIGTERM, so the background work is wound down before exit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var background sync.WaitGroup
 
 	client, err := pubsub.NewClient(ctx, *projectID)
 	if err != nil {
@@ -33,21 +83,122 @@ func main() {
 
 	topic := client.Topic(*topicID)
 
-	db, err := sql.Open("mysql", "processor:password@tcp(db:3306)/processor")
-	if err != nil {
-		panic(err)
+	logger := slog.New(tint.NewHandler(os.Stdout, nil))
+	primaryStorage := mustOpenStorage(*dsn, *expiry, logger)
+	var storage processing.Storage = primaryStorage
+	if *secondaryDSN != "" {
+		policy, err := dualwrite.ParsePolicy(*secondaryPolicy)
+		if err != nil {
+			panic(err)
+		}
+		dualStorage, err := dualwrite.New(storage, mustOpenStorage(*secondaryDSN, *expiry, logger), policy, logger)
+		if err != nil {
+			panic(err)
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			dualStorage.Run(ctx)
+		}()
+		storage = dualStorage
 	}
 
-	logger := slog.New(tint.NewHandler(os.Stdout, nil))
-	storage, err := database.New(db, logger)
+	if faultsCfg.ErrorProbability+faultsCfg.TimeoutProbability+faultsCfg.CommittedErrorProbability+faultsCfg.LatencyProbability > 0 {
+		logger.Info(fmt.Sprintf("storage fault injection is enabled: %+v", faultsCfg))
+		storage, err = faults.New(storage, faultsCfg)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var recorder *metrics.Prometheus
+	if *metricsAddr != "" {
+		recorder, err = metrics.NewPrometheus(prometheus.DefaultRegisterer, "processor")
+		if err != nil {
+			panic(err)
+		}
+		storage, err = metrics.New(storage, recorder)
+		if err != nil {
+			panic(err)
+		}
+		go func() {
+			http.Handle("/metrics", promhttp.Handler())
+			logger.Error(fmt.Sprintf("metrics server has stopped: %s", http.ListenAndServe(*metricsAddr, nil)))
+		}()
+	}
+
+	var opts []processing.Option
+	if *redact || len(redactionRules) > 0 {
+		if *redact {
+			redactionRules = append(processing.DefaultRedactionRules(), redactionRules...)
+		}
+		redactor, err := processing.NewRedactor(redactionRules...)
+		if err != nil {
+			panic(err)
+		}
+		opts = append(opts, processing.WithRedactor(redactor))
+	}
+	if *validate {
+		opts = append(opts, processing.WithValidator(processing.NewValidator(processing.DefaultValidationConfig())))
+		if *quarantine {
+			opts = append(opts, processing.WithQuarantine(primaryStorage))
+		}
+	}
+
+	if *maxSkew > 0 {
+		action, err := processing.ParseSkewAction(*skewAction)
+		if err != nil {
+			panic(err)
+		}
+		policy := processing.SkewPolicy{MaxSkew: *maxSkew, Action: action}
+		// -quarantine only concerns validation, scans from the future have their own switch
+		if action == processing.SkewQuarantine {
+			policy.Quarantine = primaryStorage
+		}
+		opts = append(opts, processing.WithSkewPolicy(policy))
+	}
+
+	interceptors := []processing.Interceptor{processing.Recover(logger)}
+	var keep []string
+	for _, service := range strings.Split(*services, ",") {
+		if service = strings.TrimSpace(service); service != "" {
+			keep = append(keep, service)
+		}
+	}
+	if len(keep) > 0 {
+		interceptors = append(interceptors, processing.Filter(func(scn *processing.ScanResult) bool {
+			return slices.Contains(keep, scn.Service())
+		}))
+	}
+	if *geoIP != "" {
+		enricher, err := processing.NewEnricher(*geoIP, logger)
+		if err != nil {
+			panic(err)
+		}
+		go enricher.Watch(ctx, *geoIPReload)
+		go reloadOnHangup(enricher.Reload, "GeoIP database", logger)
+		interceptors = append(interceptors, enricher.Interceptor())
+	}
+	if *fingerprints != "" {
+		fingerprinter, err := processing.NewFingerprinter(*fingerprints, logger)
+		if err != nil {
+			panic(err)
+		}
+		go fingerprinter.Watch(ctx, *fingerprintsReload)
+		go reloadOnHangup(fingerprinter.Reload, "fingerprint rules", logger)
+		interceptors = append(interceptors, fingerprinter.Interceptor())
+	}
+	opts = append(opts, processing.WithInterceptors(interceptors...))
+
+	prcssr, err := processing.New(storage, opts...)
 	if err != nil {
 		panic(err)
 	}
-
-	prcssr, err := processing.New(storage)
+	dispatcher, err := processing.NewDispatcher(prcssr, *workers, *queueSize)
 	if err != nil {
 		panic(err)
 	}
+	defer dispatcher.Close()
 
 	sub, err := client.CreateSubscription(context.Background(), *subID,
 		pubsub.SubscriptionConfig{Topic: topic})
@@ -55,38 +206,91 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	// don't lease more messages than the workers can hold, the rest stays in Pub/Sub
+	sub.ReceiveSettings.MaxOutstandingMessages = *workers * (*queueSize + 1)
 
-	err = sub.Receive(context.Background(), func(ctx context.Context, m *pubsub.Message) {
-		logger.Info(fmt.Sprintf("Got message: %s", m.Data))
+	err = sub.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+		contentType := m.Attributes[scanning.AttrContentType]
+		payload, err := scanning.Decompress(m.Attributes[scanning.AttrContentEncoding], m.Data, *maxPayload)
+		if err != nil {
+			// neither a bomb nor garbage gets any better on redelivery
+			logger.Error(fmt.Sprintf("cannot decompress received scan results (%d bytes, %s encoding): %s",
+				len(m.Data), m.Attributes[scanning.AttrContentEncoding], err))
+			m.Ack()
+			return
+		}
+		// payloads are never logged, responses may carry secrets the redaction rules remove from the stored data only
+		logger.Info(fmt.Sprintf("Got %s message (%d bytes)", cmp.Or(contentType, scanning.ContentTypeJSON), len(payload)))
 		scanData := &scanning.Scan{}
-		err := json.Unmarshal(m.Data, scanData)
+		err = scanning.Unmarshal(contentType, payload, scanData)
 		if err != nil {
-			logger.Error(fmt.Sprintf("cannot parse received scan results [%s]: %s", string(m.Data), err))
+			logger.Error(fmt.Sprintf("cannot parse received scan results (%s, %d bytes): %s",
+				cmp.Or(contentType, scanning.ContentTypeJSON), len(payload), err))
+			m.Ack()
+			return
+		}
+		scanResult, err := processing.ScanResultOf(scanData)
+		var decodeErr *processing.DecodeError
+		if errors.As(err, &decodeErr) {
+			// no retry would help - ack it, so it doesn't circle forever
+			logger.Error(fmt.Sprintf("cannot decode scan result %s: %s", describe(scanData, len(payload)), err))
 			m.Ack()
 			return
 		}
 		processingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
-		n, err := prcssr.Process(processingCtx, processing.NewScanResult(
-			scanData.Ip,
-			scanData.Port,
-			scanData.Service,
-			scanData.Timestamp,
-			scanData.Data,
-			uint8(scanData.DataVersion),
-		))
-		if err != nil {
-			logger.Error(fmt.Sprintf("data processing error: %s, [Service: %s, IP: %s, Port: %d, Timestamp: %s, Data: %s]",
-				err, scanData.Service, scanData.Ip, scanData.Port, time.Unix(scanData.Timestamp, 0).Format(time.RFC3339), string(m.Data)))
+		res, err := dispatcher.Dispatch(processingCtx, scanResult)
+		if recorder != nil && (err == nil || res.Outcome == database.Rejected) {
+			recorder.IncResult(res)
+		}
+		switch {
+		case res.Outcome == database.Rejected && res.Reason == string(processing.ReasonDropped):
+			logger.Info(fmt.Sprintf("scan result dropped %s", describe(scanData, len(payload))))
+		case res.Outcome == database.Rejected:
+			// rejected scan stays rejected no matter how many times it's retried
+			logger.Error(fmt.Sprintf("scan result rejected %s: %s", describe(scanData, len(payload)), err))
+		case err != nil:
+			logger.Error(fmt.Sprintf("data processing error: %s, %s", err, describe(scanData, len(payload))))
 			// database write error - return without acking, let some other pod to retry
 			return
+		default:
+			logger.Info(fmt.Sprintf("%s PUT operation success - %s, change: %s", describe(scanData, len(payload)), res, res.Change()))
 		}
-		logger.Info(fmt.Sprintf("[Service: %s, IP: %s, Port: %d, Timestamp: %s, Data: %s] PUT operation success - updated %d rows",
-			scanData.Service, scanData.Ip, scanData.Port, time.Unix(scanData.Timestamp, 0).Format(time.RFC3339), string(m.Data), n))
 		m.Ack()
 	})
+	stop()
+	background.Wait()
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// describe - what is logged about a received scan, its payload is left out as it may carry secrets
+func describe(scan *scanning.Scan, size int) string {
+	return fmt.Sprintf("[Service: %s, IP: %s, Port: %d, Timestamp: %s, Size: %d bytes]",
+		scan.Service, scan.Ip, scan.Port, time.Unix(scan.Timestamp, 0).Format(time.RFC3339), size)
+}
 
+func mustOpenStorage(dsn string, expiry time.Duration, logger *slog.Logger) *database.Client {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		panic(err)
+	}
+	storage, err := database.New(db, logger, database.WithExpiry(expiry))
 	if err != nil {
 		panic(err)
 	}
+	return storage
+}
+
+// reloadOnHangup - calls reload on every SIGHUP, what is being reloaded is named in the errors
+func reloadOnHangup(reload func() error, what string, logger *slog.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := reload(); err != nil {
+			logger.Error(fmt.Sprintf("%s is not reloaded, keeping the previous one: %s", what, err))
+		}
+	}
 }
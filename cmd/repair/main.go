@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/lmittmann/tint"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// finds records poisoned by scanners with bad clocks (timestamps too far in the future)
+// and moves their timestamps back to now, so legitimate scans can update them again
+func main() {
+	dsn := flag.String("dsn", "processor:password@tcp(db:3306)/processor", "MySQL DSN")
+	maxSkew := flag.Duration("max-skew", 5*time.Minute, "Records with timestamps beyond now plus this skew are considered poisoned")
+	dryRun := flag.Bool("dry-run", false, "Only report poisoned records")
+	flag.Parse()
+
+	logger := slog.New(tint.NewHandler(os.Stdout, nil))
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		panic(err)
+	}
+	storage, err := database.New(db, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	after := now.Add(*maxSkew).Unix()
+	rows, err := storage.FindFuture(ctx, after)
+	if err != nil {
+		panic(err)
+	}
+
+	fixed, failed := 0, 0
+	for _, row := range rows {
+		msg := fmt.Sprintf("[Service: %s, IP: %s, Port: %d, Timestamp: %s]",
+			row.Service, row.IP, row.Port, time.Unix(row.Timestamp, 0).Format(time.RFC3339))
+		if *dryRun {
+			logger.Info("poisoned record found " + msg)
+			continue
+		}
+		changed, err := storage.ClampTimestamp(ctx, row, after, now.Unix())
+		if err != nil {
+			logger.Error(fmt.Sprintf("cannot repair %s: %s", msg, err))
+			failed++
+			continue
+		}
+		if changed {
+			fixed++
+			logger.Info(fmt.Sprintf("%s timestamp moved back to %s", msg, now.Format(time.RFC3339)))
+		}
+	}
+	logger.Info(fmt.Sprintf("Repair has completed: %d poisoned records found, %d repaired, %d failed", len(rows), fixed, failed))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -19,6 +19,23 @@ var (
 func main() {
 	projectId := flag.String("project", "test-project", "GCP Project ID")
 	topicId := flag.String("topic", "scan-topic", "GCP PubSub Topic ID")
+	format := flag.String("format", "json", "Message wire format: json, protobuf or mixed (a random one for every message)")
+	compression := flag.String("compression", "", "Payload compression: gzip, zstd or empty for none")
+	compressionThreshold := flag.Int("compression-threshold", 1024, "Only payloads larger than this many bytes are compressed")
+	flag.Parse()
+
+	contentTypes := map[string][]string{
+		"json":     {scanning.ContentTypeJSON},
+		"protobuf": {scanning.ContentTypeProtobuf},
+		"mixed":    {scanning.ContentTypeJSON, scanning.ContentTypeProtobuf},
+	}[*format]
+	if contentTypes == nil {
+		panic(fmt.Sprintf("unknown message format %q", *format))
+	}
+	// a typo shouldn't wait for the first payload above the threshold to surface
+	if _, err := scanning.Compress(*compression, nil); err != nil {
+		panic(err)
+	}
 
 	ctx := context.Background()
 
@@ -40,22 +57,64 @@ func main() {
 
 		serviceResp := fmt.Sprintf("service response: %d", rand.Intn(100))
 
-		if rand.Intn(2) == 0 {
-			scan.DataVersion = scanning.V1
-			scan.Data = &scanning.V1Data{ResponseBytesUtf8: []byte(serviceResp)}
-		} else {
-			scan.DataVersion = scanning.V2
-			scan.Data = &scanning.V2Data{ResponseStr: serviceResp}
+		switch rand.Intn(3) {
+		case 0:
+			err = scan.SetData(scanning.V1, &scanning.V1Data{ResponseBytesUtf8: []byte(serviceResp)})
+		case 1:
+			err = scan.SetData(scanning.V2, &scanning.V2Data{ResponseStr: serviceResp})
+		default:
+			err = scan.SetData(scanning.V3, v3Data(scan.Service, serviceResp))
+		}
+		if err != nil {
+			panic(err)
 		}
 
-		encoded, err := json.Marshal(scan)
+		contentType := contentTypes[rand.Intn(len(contentTypes))]
+		encoded, err := scanning.Marshal(contentType, scan)
 		if err != nil {
 			panic(err)
 		}
 
-		_, err = topic.Publish(ctx, &pubsub.Message{Data: encoded}).Get(ctx)
+		attributes := map[string]string{scanning.AttrContentType: contentType}
+		if *compression != "" && len(encoded) > *compressionThreshold {
+			encoded, err = scanning.Compress(*compression, encoded)
+			if err != nil {
+				panic(err)
+			}
+			attributes[scanning.AttrContentEncoding] = *compression
+		}
+
+		_, err = topic.Publish(ctx, &pubsub.Message{Data: encoded, Attributes: attributes}).Get(ctx)
 		if err != nil {
 			panic(err)
 		}
 	}
 }
+
+// v3Data - structured data with made up details of the exchange
+func v3Data(service, serviceResp string) *scanning.V3Data {
+	data := &scanning.V3Data{
+		Response: []byte(serviceResp),
+		Details: scanning.Details{
+			Transport:     scanning.TransportTCP,
+			LatencyMicros: int64(500 + rand.Intn(50000)),
+		},
+	}
+	switch service {
+	case "DNS":
+		data.Transport = scanning.TransportUDP
+		data.Request = []byte{0x12, 0x34, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	case "HTTP":
+		data.Request = []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+		if rand.Intn(2) == 0 {
+			data.TLS = &scanning.TLSInfo{
+				Version:     "TLS 1.3",
+				CipherSuite: "TLS_AES_128_GCM_SHA256",
+				ServerName:  "example.com",
+				ALPN:        "http/1.1",
+			}
+		}
+		data.Sections = map[string]json.RawMessage{"http": json.RawMessage(`{"redirects":0}`)}
+	}
+	return data
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// report - aggregate statistics printed by the tool
+type report struct {
+	Services      []database.ServiceCount `json:"services"`
+	TopPorts      []database.PortCount    `json:"top_ports"`
+	DistinctHosts int64                   `json:"distinct_hosts"`
+	RecordsPerDay []database.DayCount     `json:"records_per_day"`
+}
+
+func main() {
+	dsn := flag.String("dsn", "processor:password@tcp(db:3306)/processor", "MySQL DSN")
+	top := flag.Int("top", 10, "Number of top ports to report")
+	flag.Parse()
+	if *top <= 0 {
+		fmt.Fprintf(os.Stderr, "-top must be positive, got %d\n", *top)
+		os.Exit(2)
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		panic(err)
+	}
+	storage, err := database.New(db, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	res, err := collect(context.Background(), storage, *top)
+	if err != nil {
+		panic(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(res); err != nil {
+		panic(err)
+	}
+}
+
+func collect(ctx context.Context, agg database.Aggregator, top int) (*report, error) {
+	var (
+		res = &report{}
+		err error
+	)
+	if res.Services, err = agg.CountByService(ctx); err != nil {
+		return nil, err
+	}
+	if res.TopPorts, err = agg.TopPorts(ctx, top); err != nil {
+		return nil, err
+	}
+	if res.DistinctHosts, err = agg.CountHosts(ctx); err != nil {
+		return nil, err
+	}
+	if res.RecordsPerDay, err = agg.CountByDay(ctx); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/lmittmann/tint"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/dualwrite"
+)
+
+func main() {
+	primaryDSN := flag.String("primary-dsn", "processor:password@tcp(db:3306)/processor", "Primary (source of truth) MySQL DSN")
+	secondaryDSN := flag.String("secondary-dsn", "", "Secondary (migration target) MySQL DSN")
+	repair := flag.Bool("repair", false, "Copy the freshest version of every diverged record into the lagging storage")
+	flag.Parse()
+
+	logger := slog.New(tint.NewHandler(os.Stdout, nil))
+	if *secondaryDSN == "" {
+		logger.Error("secondary storage DSN is required")
+		os.Exit(2)
+	}
+
+	primary := mustOpen(*primaryDSN, logger)
+	secondary := mustOpen(*secondaryDSN, logger)
+
+	ctx := context.Background()
+	report, err := dualwrite.Verify(ctx, primary, secondary)
+	if err != nil {
+		panic(err)
+	}
+	for _, d := range report.Divergences {
+		logger.Error(fmt.Sprintf("record %d diverged: %s [primary: %s, secondary: %s]",
+			d.Hash, d.Kind, describe(d.Primary), describe(d.Secondary)))
+	}
+	logger.Info(fmt.Sprintf("Verification has completed: %d records checked, %d diverged", report.Checked, len(report.Divergences)))
+
+	if report.Consistent() {
+		return
+	}
+	if !*repair {
+		os.Exit(1)
+	}
+	n, err := dualwrite.Repair(ctx, report, primary, secondary)
+	if err != nil {
+		logger.Error(fmt.Sprintf("repair has failed after %d records: %s", n, err))
+		os.Exit(1)
+	}
+	logger.Info(fmt.Sprintf("Repair has completed: %d of %d diverged records repaired", n, len(report.Divergences)))
+}
+
+func mustOpen(dsn string, logger *slog.Logger) *database.Client {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		panic(err)
+	}
+	storage, err := database.New(db, logger)
+	if err != nil {
+		panic(err)
+	}
+	return storage
+}
+
+func describe(row *database.ScanData) string {
+	if row == nil {
+		return "none"
+	}
+	return fmt.Sprintf("Service: %s, IP: %s, Port: %d, Timestamp: %d", row.Service, row.IP, row.Port, row.Timestamp)
+}
@@ -3,6 +3,53 @@ CREATE TABLE IF NOT EXISTS scan_results (
     service VARCHAR(255) NOT NULL,
     ip VARCHAR(64) NOT NULL,
     port INT NOT NULL,
-    data VARCHAR(255),
-    timestamp INT UNSIGNED NOT NULL
+    data MEDIUMBLOB,
+    charset VARCHAR(16) NOT NULL DEFAULT 'utf-8',
+    fields JSON,
+    details JSON,
+    content_hash CHAR(32),
+    observations INT UNSIGNED NOT NULL DEFAULT 1,
+    timestamp INT UNSIGNED NOT NULL,
+    INDEX idx_service (service),
+    INDEX idx_ip (ip),
+    INDEX idx_port (port),
+    INDEX idx_timestamp (timestamp)
+);
+
+CREATE TABLE IF NOT EXISTS scan_changes (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    hash BIGINT UNSIGNED NOT NULL,
+    service VARCHAR(255) NOT NULL,
+    ip VARCHAR(64) NOT NULL,
+    port INT NOT NULL,
+    timestamp INT UNSIGNED NOT NULL,
+    previous_timestamp INT UNSIGNED,
+    kind VARCHAR(16) NOT NULL,
+    content_hash CHAR(32),
+    INDEX idx_hash (hash),
+    INDEX idx_ip (ip),
+    INDEX idx_timestamp (timestamp),
+    INDEX idx_kind_timestamp (kind, timestamp)
+);
+
+CREATE TABLE IF NOT EXISTS host_rollup (
+    ip VARCHAR(64) PRIMARY KEY,
+    ports MEDIUMTEXT NOT NULL,
+    services MEDIUMTEXT NOT NULL,
+    last_seen INT UNSIGNED NOT NULL,
+    service_count INT NOT NULL,
+    INDEX idx_last_seen (last_seen),
+    INDEX idx_service_count (service_count)
+);
+
+CREATE TABLE IF NOT EXISTS scan_quarantine (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    service VARCHAR(255) NOT NULL,
+    ip VARCHAR(255) NOT NULL,
+    port BIGINT NOT NULL,
+    timestamp BIGINT NOT NULL,
+    data MEDIUMBLOB,
+    reason VARCHAR(64) NOT NULL,
+    quarantined_at INT UNSIGNED NOT NULL,
+    INDEX idx_reason (reason)
 );
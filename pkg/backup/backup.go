@@ -0,0 +1,168 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
+const (
+	// Format - backup file format name, stored in the header
+	Format = "scan-results-backup"
+	// Version - current backup file format version
+	Version = 1
+)
+
+// Snapshotter - storage which is able to stream a consistent snapshot of its records
+type Snapshotter interface {
+	Snapshot(ctx context.Context, fn func(row *database.ScanData) error) error
+}
+
+// header - the first line of a backup file
+type header struct {
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// record - a single scan result line, deliberately decoupled from storage representations
+type record struct {
+	IP        string `json:"ip"`
+	Port      uint32 `json:"port"`
+	Service   string `json:"service"`
+	Timestamp int64  `json:"timestamp"`
+	// Data - raw bytes, base64-encoded by JSON, so non-UTF-8 responses survive the round trip
+	Data []byte `json:"data"`
+	// Charset - detected charset of Data, absent in older backups, detected again on restore then
+	Charset string `json:"charset,omitempty"`
+	// Fields - structured fields parsed from Data, absent in older backups
+	Fields map[string]string `json:"fields,omitempty"`
+	// Details - details of the latest scanner exchange, absent in older backups and for pre-V3 scans
+	Details *scanning.Details `json:"details,omitempty"`
+	// Observations - number of scans stored in the record, absent in older backups, restored as 1 then
+	Observations uint64 `json:"observations,omitempty"`
+}
+
+// trailer - the last line of a backup file, lets restore detect truncated files
+type trailer struct {
+	Count int `json:"count"`
+}
+
+// line - union of all the line kinds, records are the only lines with a service
+type line struct {
+	record
+	Count *int `json:"count,omitempty"`
+}
+
+// RestoreStats - restore summary
+type RestoreStats struct {
+	// Read - records read from the backup
+	Read int
+	// Written - records which were inserted or replaced older stored data
+	Written int
+	// Skipped - records ignored because the storage already had data as fresh as theirs or fresher
+	Skipped int
+}
+
+// Dump - writes a gzip-compressed snapshot of the source storage into w, returns the number of records
+func Dump(ctx context.Context, src Snapshotter, w io.Writer) (int, error) {
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	if err := enc.Encode(header{Format: Format, Version: Version, CreatedAt: time.Now().Unix()}); err != nil {
+		return 0, err
+	}
+	count := 0
+	err := src.Snapshot(ctx, func(row *database.ScanData) error {
+		count++
+		return enc.Encode(record{
+			IP:           row.IP,
+			Port:         row.Port,
+			Service:      row.Service,
+			Timestamp:    row.Timestamp,
+			Data:         []byte(row.Data),
+			Charset:      row.Charset,
+			Fields:       row.Fields,
+			Details:      row.Details,
+			Observations: row.Observations,
+		})
+	})
+	if err != nil {
+		return count, fmt.Errorf("cannot take storage snapshot: %w", err)
+	}
+	if err := enc.Encode(trailer{Count: count}); err != nil {
+		return count, err
+	}
+	return count, zw.Close()
+}
+
+// Restore - merges a backup into the destination storage with newest-wins rules, records are restored
+// as they are (see database.Loader), records not fresher than the stored ones are skipped,
+// stats are returned even if restore fails halfway
+func Restore(ctx context.Context, r io.Reader, dst database.Loader) (*RestoreStats, error) {
+	stats := &RestoreStats{}
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return stats, fmt.Errorf("not a backup file: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+
+	scanner := bufio.NewScanner(zr)
+	// service responses may be large - don't limit lines to the default 64KB
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	if !scanner.Scan() {
+		return stats, fmt.Errorf("not a backup file: %w", errors.Join(scanner.Err(), io.ErrUnexpectedEOF))
+	}
+	var h header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil || h.Format != Format {
+		return stats, fmt.Errorf("not a backup file: bad header")
+	}
+	if h.Version != Version {
+		return stats, fmt.Errorf("unsupported backup version %d", h.Version)
+	}
+
+	for scanner.Scan() {
+		var l line
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			return stats, fmt.Errorf("corrupt backup record #%d: %w", stats.Read+1, err)
+		}
+		if l.Count != nil {
+			if *l.Count != stats.Read {
+				return stats, fmt.Errorf("corrupt backup: trailer expects %d records, got %d", *l.Count, stats.Read)
+			}
+			return stats, nil
+		}
+		stats.Read++
+		row := &database.ScanData{
+			IP:           l.IP,
+			Port:         l.Port,
+			Service:      l.Service,
+			Timestamp:    l.Timestamp,
+			Data:         string(l.Data),
+			Charset:      l.Charset,
+			Fields:       l.Fields,
+			Details:      l.Details,
+			Observations: l.Observations,
+		}
+		res, err := dst.Load(ctx, row, false)
+		if err != nil {
+			return stats, fmt.Errorf("cannot restore record [Service: %s, IP: %s, Port: %d]: %w", l.Service, l.IP, l.Port, err)
+		}
+		if !res.Outcome.Written() {
+			stats.Skipped++
+		} else {
+			stats.Written++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("cannot read backup: %w", err)
+	}
+	return stats, fmt.Errorf("truncated backup: no trailer after %d records", stats.Read)
+}
@@ -0,0 +1,122 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/memory"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
+type BackupSuite struct {
+	suite.Suite
+}
+
+func TestBackupSuite(t *testing.T) {
+	suite.Run(t, &BackupSuite{})
+}
+
+func (s *BackupSuite) put(st *memory.Store, ip string, ts int64, data string) {
+	_, err := st.Put(context.TODO(), (&database.ScanData{IP: ip, Port: 53, Service: "DNS", Timestamp: ts, Data: data}).AsScan())
+	s.NoError(err)
+}
+
+func (s *BackupSuite) TestDumpAndRestore() {
+	src := memory.New()
+	s.put(src, "1.1.1.1", 100, "old in backup")
+	s.put(src, "1.1.1.2", 200, "new in backup")
+	s.put(src, "1.1.1.3", 250, "\x00\xffbinary")
+	s.put(src, "1.1.1.3", 300, "\x00\xffbinary")
+	_, err := src.Put(context.TODO(), (&database.ScanData{IP: "1.1.1.4", Port: 22, Service: "SSH", Timestamp: 400,
+		Data: "SSH-2.0-OpenSSH_9.6", Fields: map[string]string{"software": "OpenSSH_9.6"},
+		Details: &scanning.Details{Transport: scanning.TransportTCP, LatencyMicros: 1200}}).AsScan())
+	s.NoError(err)
+
+	buf := &bytes.Buffer{}
+	n, err := Dump(context.TODO(), src, buf)
+	s.NoError(err)
+	s.Equal(4, n)
+
+	dst := memory.New()
+	s.put(dst, "1.1.1.1", 150, "newer in destination")
+	s.put(dst, "1.1.1.2", 150, "older in destination")
+
+	stats, err := Restore(context.TODO(), bytes.NewReader(buf.Bytes()), dst)
+	s.NoError(err)
+	s.Equal(&RestoreStats{Read: 4, Written: 3, Skipped: 1}, stats)
+
+	rows, err := dst.GetAll(context.TODO())
+	s.NoError(err)
+	s.Len(rows, 4)
+	data := map[string]string{}
+	fields := map[string]map[string]string{}
+	details := map[string]*scanning.Details{}
+	observations := map[string]uint64{}
+	for _, row := range rows {
+		data[row.IP] = row.Data
+		fields[row.IP] = row.Fields
+		details[row.IP] = row.Details
+		observations[row.IP] = row.Observations
+	}
+	s.Equal(map[string]string{
+		"1.1.1.1": "newer in destination",
+		"1.1.1.2": "new in backup",
+		"1.1.1.3": "\x00\xffbinary",
+		"1.1.1.4": "SSH-2.0-OpenSSH_9.6",
+	}, data)
+	s.Equal(map[string]string{"software": "OpenSSH_9.6"}, fields["1.1.1.4"])
+	s.Equal(&scanning.Details{Transport: scanning.TransportTCP, LatencyMicros: 1200}, details["1.1.1.4"])
+	s.Nil(details["1.1.1.3"])
+	// restored as they were stored, not as new scans
+	s.EqualValues(2, observations["1.1.1.3"])
+	changes, err := dst.Changes(context.TODO(), database.ChangeFilter{})
+	s.NoError(err)
+	s.Len(changes, 2)
+
+	// older backups have no observations
+	buf.Reset()
+	zw := gzip.NewWriter(buf)
+	_, _ = zw.Write([]byte(`{"format":"scan-results-backup","version":1}` + "\n" +
+		`{"ip":"1.1.1.5","port":53,"service":"DNS","timestamp":1,"data":"eA=="}` + "\n" + `{"count":1}` + "\n"))
+	s.NoError(zw.Close())
+	_, err = Restore(context.TODO(), buf, dst)
+	s.NoError(err)
+	rows, err = dst.GetAll(context.TODO())
+	s.NoError(err)
+	s.EqualValues(1, rows[database.Hash((&database.ScanData{IP: "1.1.1.5", Port: 53, Service: "DNS"}).AsScan())].Observations)
+}
+
+func (s *BackupSuite) TestRestoreErrors() {
+	gz := func(content string) []byte {
+		buf := &bytes.Buffer{}
+		zw := gzip.NewWriter(buf)
+		_, _ = zw.Write([]byte(content))
+		_ = zw.Close()
+		return buf.Bytes()
+	}
+	testCases := []struct {
+		title string
+		input []byte
+	}{
+		{title: "Not gzip", input: []byte("plain text")},
+		{title: "Empty", input: gz("")},
+		{title: "Bad header", input: gz(`{"format":"something else","version":1}` + "\n")},
+		{title: "Unsupported version", input: gz(`{"format":"scan-results-backup","version":99}` + "\n")},
+		{title: "Corrupt record", input: gz(`{"format":"scan-results-backup","version":1}` + "\n{\n")},
+		{title: "Truncated", input: gz(`{"format":"scan-results-backup","version":1}` + "\n" +
+			`{"ip":"1.1.1.1","port":53,"service":"DNS","timestamp":1,"data":"eA=="}` + "\n")},
+		{title: "Count mismatch", input: gz(`{"format":"scan-results-backup","version":1}` + "\n" +
+			`{"ip":"1.1.1.1","port":53,"service":"DNS","timestamp":1,"data":"eA=="}` + "\n" + `{"count":2}` + "\n")},
+	}
+	for _, tc := range testCases {
+		s.Run(tc.title, func() {
+			_, err := Restore(context.TODO(), bytes.NewReader(tc.input), memory.New())
+			s.Error(err)
+		})
+	}
+}
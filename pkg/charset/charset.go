@@ -0,0 +1,78 @@
+package charset
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Supported charsets
+const (
+	// UTF8 - valid UTF-8 text (including plain ASCII)
+	UTF8 = "utf-8"
+	// Latin1 - 8-bit text which is not valid UTF-8, decoded as Windows-1252 (a superset of ISO-8859-1)
+	Latin1 = "windows-1252"
+	// Binary - anything that doesn't look like text
+	Binary = "binary"
+)
+
+// maxControlRatio - text with more control characters than this is considered binary
+const maxControlRatio = 0.1
+
+// Detect - guesses the charset of a service response
+func Detect(b []byte) string {
+	if utf8.Valid(b) {
+		return UTF8
+	}
+	controls := 0
+	for _, c := range b {
+		if c == 0 {
+			return Binary
+		}
+		if c < 0x20 && c != '\t' && c != '\r' && c != '\n' {
+			controls++
+		}
+	}
+	if float64(controls) > maxControlRatio*float64(len(b)) {
+		return Binary
+	}
+	return Latin1
+}
+
+// Display - safely displayable representation of a service response: valid UTF-8 without control characters,
+// text charsets are converted to UTF-8, anything not printable is escaped Go-style (e.g. \x00, \n)
+func Display(b []byte, charset string) string {
+	text := string(b)
+	switch charset {
+	case UTF8:
+		if !utf8.Valid(b) {
+			return escape(text)
+		}
+	case Latin1:
+		decoded, err := charmap.Windows1252.NewDecoder().Bytes(b)
+		if err != nil {
+			return escape(text)
+		}
+		text = string(decoded)
+	default:
+		return escape(text)
+	}
+	var sb strings.Builder
+	for _, r := range text {
+		if unicode.IsPrint(r) || r == ' ' {
+			sb.WriteRune(r)
+			continue
+		}
+		sb.WriteString(strings.Trim(strconv.QuoteRune(r), "'"))
+	}
+	return sb.String()
+}
+
+// escape - every invalid UTF-8 byte and non-printable rune is escaped
+func escape(s string) string {
+	quoted := strconv.QuoteToGraphic(s)
+	return quoted[1 : len(quoted)-1]
+}
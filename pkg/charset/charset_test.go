@@ -0,0 +1,70 @@
+package charset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CharsetSuite struct {
+	suite.Suite
+}
+
+func TestCharsetSuite(t *testing.T) {
+	suite.Run(t, &CharsetSuite{})
+}
+
+func (s *CharsetSuite) TestDetectAndDisplay() {
+	testCases := []struct {
+		title           string
+		input           []byte
+		expectedCharset string
+		expectedDisplay string
+	}{
+		{
+			title:           "ASCII",
+			input:           []byte("hello world"),
+			expectedCharset: UTF8,
+			expectedDisplay: "hello world",
+		},
+		{
+			title:           "UTF-8 with control characters",
+			input:           []byte("SSH-2.0-Привет\r\n"),
+			expectedCharset: UTF8,
+			expectedDisplay: `SSH-2.0-Привет\r\n`,
+		},
+		{
+			title:           "Latin-1",
+			input:           []byte("caf\xe9 \x80"),
+			expectedCharset: Latin1,
+			expectedDisplay: "café €",
+		},
+		{
+			title:           "Binary with NUL",
+			input:           []byte("\x16\x03\x01\x00\xa5"),
+			expectedCharset: Binary,
+			expectedDisplay: `\x16\x03\x01\x00\xa5`,
+		},
+		{
+			title:           "Binary with lots of control characters",
+			input:           []byte("\x01\x02\x03\xff"),
+			expectedCharset: Binary,
+			expectedDisplay: `\x01\x02\x03\xff`,
+		},
+		{
+			title:           "Empty",
+			input:           []byte{},
+			expectedCharset: UTF8,
+			expectedDisplay: "",
+		},
+	}
+	for _, tc := range testCases {
+		s.Run(tc.title, func() {
+			charset := Detect(tc.input)
+			s.Equal(tc.expectedCharset, charset)
+			s.Equal(tc.expectedDisplay, Display(tc.input, charset))
+		})
+	}
+	// charset lies - never display invalid UTF-8 as is
+	s.Equal(`\xff`, Display([]byte{0xff}, UTF8))
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultExpiry - records not seen for longer than this are considered expired,
+// the next scan of such a record is classified as ChangeReappeared
+const DefaultExpiry = 7 * 24 * time.Hour
+
+// Change - kind of change a processed scan represents
+type Change uint8
+
+// Changes
+const (
+	// ChangeNone - nothing was written: the scan was rejected, dropped or failed
+	ChangeNone Change = iota
+	// ChangeNew - first scan of the service
+	ChangeNew
+	// ChangeChanged - the response differs from the stored one
+	ChangeChanged
+	// ChangeUnchanged - the response is the same as the stored one
+	ChangeUnchanged
+	// ChangeStale - the scan is older than the stored one, nothing was written
+	ChangeStale
+	// ChangeReappeared - the first scan since the record expired, whether its response changed or not
+	ChangeReappeared
+)
+
+var changeNames = [...]string{
+	ChangeNone:       "none",
+	ChangeNew:        "new",
+	ChangeChanged:    "changed",
+	ChangeUnchanged:  "unchanged",
+	ChangeStale:      "stale",
+	ChangeReappeared: "reappeared",
+}
+
+// String - change name, as it's stored in the change log
+func (c Change) String() string {
+	if int(c) < len(changeNames) {
+		return changeNames[c]
+	}
+	return fmt.Sprintf("change(%d)", c)
+}
+
+// ParseChange - converts a change name into Change
+func ParseChange(name string) (Change, error) {
+	for c, n := range changeNames {
+		if n == name {
+			return Change(c), nil
+		}
+	}
+	return ChangeNone, fmt.Errorf("unknown change %q", name)
+}
+
+// Logged - true for changes which are written into the change log: new, changed and reappeared records
+func (c Change) Logged() bool {
+	return c == ChangeNew || c == ChangeChanged || c == ChangeReappeared
+}
+
+// ChangeOf - change represented by the outcome, ChangeNone for rejected and failed scans
+func ChangeOf(outcome Outcome) Change {
+	switch outcome {
+	case Inserted:
+		return ChangeNew
+	case Updated:
+		return ChangeChanged
+	case Unchanged:
+		return ChangeUnchanged
+	case Stale:
+		return ChangeStale
+	case Reappeared:
+		return ChangeReappeared
+	default:
+		return ChangeNone
+	}
+}
+
+// Expired - true if the record last seen at previous had expired by the time of the scan, expiry 0 never expires
+func Expired(previous, timestamp int64, expiry time.Duration) bool {
+	return expiry > 0 && timestamp-previous > int64(expiry/time.Second)
+}
+
+// ChangeRecord - change log entry
+type ChangeRecord struct {
+	ID        int64  `sql:"id"`
+	Hash      uint64 `sql:"hash"`
+	Service   string `sql:"service"`
+	IP        string `sql:"ip"`
+	Port      uint32 `sql:"port"`
+	Timestamp int64  `sql:"timestamp"`
+	// Previous - timestamp of the scan the change replaced, 0 for new records
+	Previous    int64  `sql:"previous_timestamp"`
+	Change      Change `sql:"kind"`
+	ContentHash string `sql:"content_hash"`
+}
+
+// ChangeFilter - change log query, zero fields match everything
+type ChangeFilter struct {
+	IP      string
+	Service string
+	Changes []Change
+	// Since - only changes made by scans at or after this timestamp
+	Since int64
+	// Limit - maximum number of entries, DefaultChangesLimit if not set
+	Limit int
+}
+
+// DefaultChangesLimit - default maximum number of change log entries returned at once
+const DefaultChangesLimit = 1000
+
+// Match - true if the entry matches the filter (Limit aside)
+func (f ChangeFilter) Match(rec *ChangeRecord) bool {
+	if f.IP != "" && rec.IP != f.IP {
+		return false
+	}
+	if f.Service != "" && rec.Service != f.Service {
+		return false
+	}
+	if len(f.Changes) > 0 && !slices.Contains(f.Changes, rec.Change) {
+		return false
+	}
+	return rec.Timestamp >= f.Since
+}
+
+// Changes - change log entries matching the filter, the most recent first
+func (c *Client) Changes(ctx context.Context, f ChangeFilter) ([]*ChangeRecord, error) {
+	query, args := getChangesQuery(f)
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var res []*ChangeRecord
+	for rows.Next() {
+		var (
+			rec      = &ChangeRecord{}
+			previous sql.NullInt64
+			kind     string
+		)
+		if err := rows.Scan(&rec.ID, &rec.Hash, &rec.Service, &rec.IP, &rec.Port, &rec.Timestamp,
+			&previous, &kind, &rec.ContentHash); err != nil {
+			return nil, err
+		}
+		if rec.Change, err = ParseChange(kind); err != nil {
+			return nil, fmt.Errorf("malformed change log entry %d: %w", rec.ID, err)
+		}
+		rec.Previous = previous.Int64
+		res = append(res, rec)
+	}
+	return res, rows.Err()
+}
+
+// logChange - writes a change log entry within the transaction, previous is 0 for new records
+func logChange(ctx context.Context, tx *sql.Tx, scan Scan, change Change, previous int64, contentHash string) error {
+	_, err := tx.ExecContext(ctx, getChangeInsertQuery(), Hash(scan), scan.Service(), scan.IP(), scan.Port(), scan.Timestamp(),
+		sql.NullInt64{Int64: previous, Valid: previous != 0}, change.String(), contentHash)
+	return err
+}
+
+func getChangeInsertQuery() string {
+	return `INSERT INTO scan_changes (hash, service, ip, port, timestamp, previous_timestamp, kind, content_hash)
+				VALUES (?,?,?,?,?,?,?,?);`
+}
+
+func getChangesQuery(f ChangeFilter) (string, []any) {
+	var (
+		conditions = []string{"timestamp >= ?"}
+		args       = []any{f.Since}
+	)
+	if f.IP != "" {
+		conditions = append(conditions, "ip = ?")
+		args = append(args, f.IP)
+	}
+	if f.Service != "" {
+		conditions = append(conditions, "service = ?")
+		args = append(args, f.Service)
+	}
+	if len(f.Changes) > 0 {
+		conditions = append(conditions, "kind IN (?"+strings.Repeat(",?", len(f.Changes)-1)+")")
+		for _, change := range f.Changes {
+			args = append(args, change.String())
+		}
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultChangesLimit
+	}
+	args = append(args, limit)
+	return `SELECT id, hash, service, ip, port, timestamp, previous_timestamp, kind, content_hash FROM scan_changes
+				WHERE ` + strings.Join(conditions, " AND ") + `
+				ORDER BY timestamp DESC, id DESC LIMIT ?;`, args
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func (s *ClientSuite) TestPutReappeared() {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(&CustomUint64Converter{}))
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil, WithExpiry(time.Hour))
+	s.NoError(err)
+
+	input := &testData{ip: "10.0.0.1", port: 22, service: "SSH", timestamp: 10000, data: "SSH-2.0-OpenSSH_9.6"}
+	contentHash := ContentHash(input.data)
+	// the same response, but the service hasn't been seen for more than an hour
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).
+		WithArgs(Hash(input)).
+		WillReturnRows(sqlmock.NewRows([]string{"content_hash", "timestamp"}).AddRow(contentHash, 6399))
+	mock.ExpectExec(`UPDATE\s+scan_results\s+SET\s+timestamp = \?, fields = \?`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO scan_changes .*").WithArgs(Hash(input), input.service, input.ip, input.port, input.timestamp,
+		int64(6399), "reappeared", contentHash).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	res, err := dbCli.Put(context.TODO(), input)
+	s.NoError(err)
+	s.Equal(Reappeared, res.Outcome)
+	s.Equal(ChangeReappeared, res.Change())
+
+	// right at the expiry it's still just unchanged, and isn't logged
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).
+		WithArgs(Hash(input)).
+		WillReturnRows(sqlmock.NewRows([]string{"content_hash", "timestamp"}).AddRow(contentHash, 6400))
+	mock.ExpectExec(`UPDATE\s+scan_results\s+SET\s+timestamp = \?, fields = \?`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	res, err = dbCli.Put(context.TODO(), input)
+	s.NoError(err)
+	s.Equal(Unchanged, res.Outcome)
+	s.NoError(mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestChanges() {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(&CustomUint64Converter{}))
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	columns := []string{"id", "hash", "service", "ip", "port", "timestamp", "previous_timestamp", "kind", "content_hash"}
+	mock.ExpectQuery(`SELECT id, hash, service, ip, port, timestamp, previous_timestamp, kind, content_hash FROM scan_changes\s+`+
+		`WHERE timestamp >= \? AND ip = \? AND kind IN \(\?,\?\)\s+ORDER BY timestamp DESC, id DESC LIMIT \?;`).
+		WithArgs(int64(100), "1.1.1.1", "changed", "reappeared", 10).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(2, 7, "HTTP", "1.1.1.1", 80, 300, 200, "reappeared", "b").
+			AddRow(1, 7, "HTTP", "1.1.1.1", 80, 200, 100, "changed", "a"))
+
+	changes, err := dbCli.Changes(context.TODO(), ChangeFilter{
+		IP: "1.1.1.1", Changes: []Change{ChangeChanged, ChangeReappeared}, Since: 100, Limit: 10,
+	})
+	s.NoError(err)
+	s.Equal([]*ChangeRecord{
+		{ID: 2, Hash: 7, Service: "HTTP", IP: "1.1.1.1", Port: 80, Timestamp: 300, Previous: 200, Change: ChangeReappeared, ContentHash: "b"},
+		{ID: 1, Hash: 7, Service: "HTTP", IP: "1.1.1.1", Port: 80, Timestamp: 200, Previous: 100, Change: ChangeChanged, ContentHash: "a"},
+	}, changes)
+
+	// new records have no previous timestamp, unknown kinds are reported
+	mock.ExpectQuery(`FROM scan_changes\s+WHERE timestamp >= \?\s+ORDER BY`).
+		WithArgs(int64(0), DefaultChangesLimit).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 7, "HTTP", "1.1.1.1", 80, 100, nil, "new", "a"))
+	changes, err = dbCli.Changes(context.TODO(), ChangeFilter{})
+	s.NoError(err)
+	s.Require().Len(changes, 1)
+	s.Equal(ChangeNew, changes[0].Change)
+	s.Zero(changes[0].Previous)
+
+	mock.ExpectQuery(`FROM scan_changes`).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 7, "HTTP", "1.1.1.1", 80, 100, nil, "vanished", "a"))
+	_, err = dbCli.Changes(context.TODO(), ChangeFilter{})
+	s.Error(err)
+	s.NoError(mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestChangeNames() {
+	for c := ChangeNone; c <= ChangeReappeared; c++ {
+		parsed, err := ParseChange(c.String())
+		s.NoError(err)
+		s.Equal(c, parsed)
+	}
+	_, err := ParseChange("vanished")
+	s.Error(err)
+	s.Equal(ChangeNone, ChangeOf(Rejected))
+	s.Equal(ChangeNone, ChangeOf(Unknown))
+	s.True(ChangeNew.Logged())
+	s.False(ChangeUnchanged.Logged())
+	s.False(ChangeStale.Logged())
+}
+
+func (s *ClientSuite) TestResults() {
+	s.Equal("inserted", Result{Outcome: Inserted}.String())
+	s.Equal("rejected: invalid_ip", Rejection("invalid_ip").String())
+	s.Equal("outcome(42)", Outcome(42).String())
+	s.Equal(ChangeNone, Rejection("invalid_ip").Change())
+	s.Equal(ChangeUnchanged, Result{Outcome: Unchanged}.Change())
+	for _, o := range []Outcome{Inserted, Updated, Unchanged, Reappeared} {
+		s.True(o.Written(), o.String())
+	}
+	for _, o := range []Outcome{Unknown, Stale, Rejected} {
+		s.False(o.Written(), o.String())
+	}
+}
@@ -3,7 +3,10 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/spaolacci/murmur3"
@@ -24,12 +27,23 @@ type Scan interface {
 
 // Client - DB client wrapper
 type Client struct {
-	db  *sql.DB
-	log Logger
+	db     *sql.DB
+	log    Logger
+	expiry time.Duration
+}
+
+// ClientOption - Client configuration option
+type ClientOption func(c *Client)
+
+// WithExpiry - records not seen for longer than expiry are considered expired, DefaultExpiry by default, 0 disables expiry
+func WithExpiry(expiry time.Duration) ClientOption {
+	return func(c *Client) {
+		c.expiry = expiry
+	}
 }
 
 // New - Client constructor
-func New(db *sql.DB, log Logger) (*Client, error) {
+func New(db *sql.DB, log Logger, opts ...ClientOption) (*Client, error) {
 	if db == nil {
 		return nil, fmt.Errorf("no database handle provided")
 	}
@@ -42,60 +56,166 @@ func New(db *sql.DB, log Logger) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{db, &NullSafeLogger{log}}, nil
+	c := &Client{db: db, log: &NullSafeLogger{log}, expiry: DefaultExpiry}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Put - insert or update scan results, the host rollup (see GetHost) is kept in sync within the same transaction
+// unchanged responses (see ContentHash) are not rewritten, the record is just marked as seen again
+// every new, changed or reappeared record is written into the change log (see Changes) within the same transaction
+// returns one of Stale, Inserted, Updated, Unchanged or Reappeared outcomes
+func (c *Client) Put(ctx context.Context, scan Scan) (Result, error) {
+	results, err := c.PutBatch(ctx, []Scan{scan})
+	if err != nil {
+		return Result{}, err
+	}
+	return results[0], nil
 }
 
-// Put - insert or update scan results
-func (c *Client) Put(ctx context.Context, scan Scan) (int64, error) {
+// PutBatch - like Put, but writes all the scans in a single transaction, either all of them are written or none
+// returns Put results in the order of scans, scans of the same record are applied in that order too
+func (c *Client) PutBatch(ctx context.Context, scans []Scan) ([]Result, error) {
+	if len(scans) == 0 {
+		return nil, nil
+	}
 	// start transaction
 	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{
 		Isolation: sql.LevelReadCommitted,
 	})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
+	// serialize writes of the same host, so concurrent rollup refreshes never miss each other's rows,
+	// hosts are always locked in the same order, so concurrent batches cannot deadlock
+	ips := make([]string, 0, len(scans))
+	for _, scan := range scans {
+		ips = append(ips, scan.IP())
+	}
+	slices.Sort(ips)
+	ips = slices.Compact(ips)
+	refresh := map[string]bool{}
+	for _, ip := range ips {
+		hostCreated, err := lockHost(ctx, tx, ip)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		// a brand new host record (e.g. it predates the rollup) needs a refresh no matter what
+		refresh[ip] = hostCreated
+	}
+
+	results := make([]Result, len(scans))
+	for i, scan := range scans {
+		outcome, err := c.put(ctx, tx, scan)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		results[i] = Result{Outcome: outcome}
+		// the rollup only changes when something was written
+		refresh[scan.IP()] = refresh[scan.IP()] || outcome.Written()
+	}
+
+	for _, ip := range ips {
+		if !refresh[ip] {
+			continue
+		}
+		if err := refreshHost(ctx, tx, ip); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// put - writes a single scan within the transaction, the host of the scan must be locked
+func (c *Client) put(ctx context.Context, tx *sql.Tx, scan Scan) (Outcome, error) {
 	var (
 		// get hashed record ID
-		hash   = Hash(scan)
-		exists bool
+		hash = Hash(scan)
+		// responses are stored byte for byte, the charset tells readers how to display them
+		data        = []byte(scan.Data())
+		dataSet     = CharsetOf(scan)
+		contentHash = ContentHash(scan.Data())
+		storedHash  sql.NullString
+		storedTime  int64
+		fields      sql.NullString
+		details     sql.NullString
 	)
-	row := tx.QueryRow(getExistsQuery(), hash)
+	if f := FieldsOf(scan); len(f) > 0 {
+		b, err := json.Marshal(f)
+		if err != nil {
+			return Unknown, err
+		}
+		fields = sql.NullString{String: string(b), Valid: true}
+	}
+	if d := DetailsOf(scan); d != nil {
+		b, err := json.Marshal(d)
+		if err != nil {
+			return Unknown, err
+		}
+		details = sql.NullString{String: string(b), Valid: true}
+	}
+	row := tx.QueryRowContext(ctx, getContentHashQuery(), hash)
 
-	// see if the service scan data already exists
-	if err := row.Scan(&exists); err != nil {
+	// see if the service scan data already exists, what its response was and when it was seen
+	err := row.Scan(&storedHash, &storedTime)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		// bad error - fall
-		_ = tx.Rollback()
-		return 0, err
+		return Unknown, err
 	}
 
-	if !exists {
+	if errors.Is(err, sql.ErrNoRows) {
 		// oh, it's the first time we got this service data - INSERT!
 		_, err := tx.ExecContext(ctx, getInsertQuery(), hash, scan.Service(),
-			scan.IP(), scan.Port(), scan.Timestamp(), scan.Data())
-
-		if err == nil {
-			return 1, tx.Commit()
+			scan.IP(), scan.Port(), scan.Timestamp(), data, dataSet, fields, details, contentHash)
+		if err != nil {
+			return Unknown, err
+		}
+		if err := logChange(ctx, tx, scan, ChangeNew, 0, contentHash); err != nil {
+			return Unknown, err
 		}
-		_ = tx.Rollback()
-		return 0, err
+		return Inserted, nil
 	}
 
-	// the service record exists - do conditional update
-	res, err := tx.ExecContext(ctx, getUpdateQuery(), scan.Timestamp(), scan.Data(), hash, scan.Timestamp())
-
+	// the service record exists - do conditional update, the response is only rewritten if it has changed
+	var (
+		res     sql.Result
+		outcome Outcome
+	)
+	if storedHash.Valid && storedHash.String == contentHash {
+		outcome = Unchanged
+		res, err = tx.ExecContext(ctx, getRefreshQuery(), scan.Timestamp(), fields, details, hash, scan.Timestamp())
+	} else {
+		outcome = Updated
+		res, err = tx.ExecContext(ctx, getUpdateQuery(), scan.Timestamp(), data, dataSet, fields, details, contentHash, hash, scan.Timestamp())
+	}
 	if err != nil {
-		_ = tx.Rollback()
-		return 0, err
+		return Unknown, err
 	}
 
 	// get affected rows - to propagate whether actual update took place or not
 	rowsAffected, _ := res.RowsAffected()
-	err = tx.Commit()
-	if err != nil {
-		return 0, err
+	if rowsAffected == 0 {
+		return Stale, nil
 	}
-	return rowsAffected, nil
+	if Expired(storedTime, scan.Timestamp(), c.expiry) {
+		outcome = Reappeared
+	}
+	if change := ChangeOf(outcome); change.Logged() {
+		if err := logChange(ctx, tx, scan, change, storedTime, contentHash); err != nil {
+			return Unknown, err
+		}
+	}
+	return outcome, nil
 }
 
 // GetAll - get all table data (purely testing purpose)
@@ -107,8 +227,8 @@ func (c *Client) GetAll(ctx context.Context) (map[uint64]*ScanData, error) {
 	defer func() { _ = rows.Close() }()
 	res := map[uint64]*ScanData{}
 	for rows.Next() {
-		row := &ScanData{}
-		if err := rows.Scan(&row.Hash, &row.Service, &row.IP, &row.Port, &row.Timestamp, &row.Data); err != nil {
+		row, err := scanData(rows)
+		if err != nil {
 			return nil, err
 		}
 		res[row.Hash] = row
@@ -119,29 +239,101 @@ func (c *Client) GetAll(ctx context.Context) (map[uint64]*ScanData, error) {
 	return res, nil
 }
 
+// Snapshot - streams every stored record into fn, all records come from the same consistent
+// point-in-time view of the table, so concurrent writes never produce a torn snapshot
+func (c *Client) Snapshot(ctx context.Context, fn func(row *ScanData) error) error {
+	// read-only REPEATABLE READ transaction reads everything from the snapshot established by its first read
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, getSelectQuery())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		row, err := scanData(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// scanData - reads a record selected with scanDataColumns
+func scanData(row interface{ Scan(dest ...any) error }) (*ScanData, error) {
+	var (
+		res     = &ScanData{}
+		fields  sql.NullString
+		details sql.NullString
+	)
+	if err := row.Scan(&res.Hash, &res.Service, &res.IP, &res.Port, &res.Timestamp, &res.Data, &res.Charset, &fields, &details, &res.Observations); err != nil {
+		return nil, err
+	}
+	if fields.Valid && fields.String != "" {
+		if err := json.Unmarshal([]byte(fields.String), &res.Fields); err != nil {
+			return nil, fmt.Errorf("malformed fields of record %d: %w", res.Hash, err)
+		}
+	}
+	if details.Valid && details.String != "" {
+		if err := json.Unmarshal([]byte(details.String), &res.Details); err != nil {
+			return nil, fmt.Errorf("malformed details of record %d: %w", res.Hash, err)
+		}
+	}
+	return res, nil
+}
+
+// scanDataColumns - columns read by scanData
+const scanDataColumns = `hash, service, ip, port, timestamp, data, charset, fields, details, observations`
+
 func getInsertQuery() string {
-	return `INSERT INTO scan_results (hash, service, ip, port, timestamp, data) VALUES (?,?,?,?,?,?);`
+	return `INSERT INTO scan_results (hash, service, ip, port, timestamp, data, charset, fields, details, content_hash, observations)
+				VALUES (?,?,?,?,?,?,?,?,?,?,1);`
 }
 
 func getSelectQuery() string {
-	return `SELECT hash, service, ip, port, timestamp, data FROM scan_results;`
+	return `SELECT ` + scanDataColumns + ` FROM scan_results;`
 }
 
-func getExistsQuery() string {
-	return `SELECT EXISTS(SELECT 1 FROM scan_results WHERE hash = ?);`
+func getContentHashQuery() string {
+	return `SELECT content_hash, timestamp FROM scan_results WHERE hash = ?;`
 }
 
 func getUpdateQuery() string {
 	return `UPDATE 
 				scan_results 
 			SET 
-				timestamp = ?, data = ? 
+				timestamp = ?, data = ?, charset = ?, fields = ?, details = ?, content_hash = ?, observations = observations + 1 
 			WHERE
 			  	hash = ? AND timestamp < ?;`
 	// wanna verify that observer truly reports broken storage logic - use the broken condition below
 	// hash = ? AND ? > 0;`
 }
 
+func getRefreshQuery() string {
+	return `UPDATE
+					scan_results
+				SET
+					timestamp = ?, fields = ?, details = ?, observations = observations + 1
+				WHERE
+					hash = ? AND timestamp < ?;`
+}
+
+// ContentHash - hash of the service response, records with the same content hash have the same response
+func ContentHash(data string) string {
+	h1, h2 := murmur3.Sum128([]byte(data))
+	return fmt.Sprintf("%016x%016x", h1, h2)
+}
+
 // Hash - returns murmur3 hash of the provided Scan result
 func Hash(scan Scan) uint64 {
 	return murmur3.Sum64([]byte(fmt.Sprintf("%s-%s-%d", scan.Service(), scan.IP(), scan.Port())))
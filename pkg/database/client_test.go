@@ -10,6 +10,9 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/charset"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
 )
 
 type CustomUint64Converter struct{}
@@ -122,49 +125,253 @@ func (s *ClientSuite) TestPut() {
 		port:      1555,
 		timestamp: time.Now().Unix(),
 	}
+	contentHash := ContentHash(input.data)
 
 	dbCli, err := New(mockDB, nil)
 	s.NoError(err)
 	s.NotNil(dbCli)
 
-	// UPDATE
+	// UPDATE - the response has changed
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).
+		WithArgs(Hash(input)).
+		WillReturnRows(sqlmock.NewRows([]string{"content_hash", "timestamp"}).AddRow(ContentHash("old data"), input.timestamp-60))
+
+	mock.ExpectExec("UPDATE .* data = .*").WithArgs(input.timestamp, []byte(input.data), charset.UTF8, nil, nil, contentHash,
+		Hash(input), input.timestamp).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO scan_changes .*").WithArgs(Hash(input), input.service, input.ip, input.port, input.timestamp,
+		input.timestamp-60, "changed", contentHash).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	res, err := dbCli.Put(context.TODO(), input)
+	s.NoError(err)
+	s.Equal(Updated, res.Outcome)
+
+	// UPDATE - the record predates content hashes
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).
+		WithArgs(Hash(input)).
+		WillReturnRows(sqlmock.NewRows([]string{"content_hash", "timestamp"}).AddRow(nil, input.timestamp-60))
+
+	mock.ExpectExec("UPDATE .* data = .*").WithArgs(input.timestamp, []byte(input.data), charset.UTF8, nil, nil, contentHash,
+		Hash(input), input.timestamp).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO scan_changes .*").WithArgs(Hash(input), input.service, input.ip, input.port, input.timestamp,
+		input.timestamp-60, "changed", contentHash).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	res, err = dbCli.Put(context.TODO(), input)
+	s.NoError(err)
+	s.Equal(Updated, res.Outcome)
+
+	// UPDATE - same response, only the timestamp is advanced
 	mock.ExpectBegin()
-	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM scan_results WHERE hash = \?\);`).
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).
 		WithArgs(Hash(input)).
-		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(1))
+		WillReturnRows(sqlmock.NewRows([]string{"content_hash", "timestamp"}).AddRow(contentHash, input.timestamp-60))
 
-	mock.ExpectExec("UPDATE *").WithArgs(input.timestamp, input.data, Hash(input), input.timestamp).
+	mock.ExpectExec(`UPDATE\s+scan_results\s+SET\s+timestamp = \?, fields = \?, details = \?, observations = observations \+ 1`).
+		WithArgs(input.timestamp, nil, nil, Hash(input), input.timestamp).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 2))
 	mock.ExpectCommit()
 
-	n, err := dbCli.Put(context.TODO(), input)
+	res, err = dbCli.Put(context.TODO(), input)
 	s.NoError(err)
-	s.Equal(int64(1), n)
+	s.Equal(Unchanged, res.Outcome)
+
+	// UPDATE - stale scan, the host rollup is left untouched
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).
+		WithArgs(Hash(input)).
+		WillReturnRows(sqlmock.NewRows([]string{"content_hash", "timestamp"}).AddRow(contentHash, input.timestamp-60))
+
+	mock.ExpectExec(`UPDATE\s+scan_results\s+SET\s+timestamp = \?, fields = \?`).
+		WithArgs(input.timestamp, nil, nil, Hash(input), input.timestamp).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	res, err = dbCli.Put(context.TODO(), input)
+	s.NoError(err)
+	s.Equal(Stale, res.Outcome)
 
 	// INSERT
 	mock.ExpectBegin()
-	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM scan_results WHERE hash = \?\);`).
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).
 		WithArgs(Hash(input)).
-		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(0))
+		WillReturnRows(sqlmock.NewRows([]string{"content_hash", "timestamp"}))
 
 	mock.ExpectExec("INSERT INTO scan_results *").WithArgs(Hash(input),
-		input.service, input.ip, input.port, input.timestamp, input.data).
+		input.service, input.ip, input.port, input.timestamp, []byte(input.data), charset.UTF8, nil, nil, contentHash).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO scan_changes .*").WithArgs(Hash(input), input.service, input.ip, input.port, input.timestamp,
+		nil, "new", contentHash).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 2))
 	mock.ExpectCommit()
 
-	n, err = dbCli.Put(context.TODO(), input)
+	res, err = dbCli.Put(context.TODO(), input)
 	s.NoError(err)
-	s.Equal(int64(1), n)
+	s.Equal(Inserted, res.Outcome)
 
 	// ScanError
 	mock.ExpectBegin()
-	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM scan_results WHERE hash = \?\);`).
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs(input.ip).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).
 		WithArgs(Hash(input)).
 		WillReturnError(fmt.Errorf("database is down"))
 
 	mock.ExpectRollback()
 
-	n, err = dbCli.Put(context.TODO(), input)
+	res, err = dbCli.Put(context.TODO(), input)
+	s.Error(err)
+	s.Zero(res)
+	s.NoError(mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestSnapshot() {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(&CustomUint64Converter{}))
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT hash, service, ip, port, timestamp, data, charset, fields, details, observations FROM scan_results;`).
+		WillReturnRows(sqlmock.NewRows([]string{"hash", "service", "ip", "port", "timestamp", "data", "charset", "fields", "details", "observations"}).
+			AddRow(1, "HTTP", "1.1.1.1", 80, 100, "one", charset.UTF8, `{"status_code":"200"}`,
+				`{"transport":"tcp","latency_us":1500,"tls":{"version":"TLS 1.3","cipher_suite":"TLS_AES_128_GCM_SHA256"}}`, 3).
+			AddRow(2, "SSH", "1.1.1.2", 22, 200, []byte("caf\xe9"), charset.Latin1, nil, nil, 1))
+	mock.ExpectRollback()
+
+	var rows []*ScanData
+	err = dbCli.Snapshot(context.TODO(), func(row *ScanData) error {
+		rows = append(rows, row)
+		return nil
+	})
+	s.NoError(err)
+	s.Equal([]*ScanData{
+		{Hash: 1, Service: "HTTP", IP: "1.1.1.1", Port: 80, Timestamp: 100, Data: "one", Charset: charset.UTF8,
+			Fields: map[string]string{"status_code": "200"}, Observations: 3,
+			Details: &scanning.Details{Transport: scanning.TransportTCP, LatencyMicros: 1500,
+				TLS: &scanning.TLSInfo{Version: "TLS 1.3", CipherSuite: "TLS_AES_128_GCM_SHA256"}}},
+		{Hash: 2, Service: "SSH", IP: "1.1.1.2", Port: 22, Timestamp: 200, Data: "caf\xe9", Charset: charset.Latin1, Observations: 1},
+	}, rows)
+	s.Equal([]byte("caf\xe9"), rows[1].Raw())
+	s.Equal("café", rows[1].Display())
+	s.NoError(mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestContentHash() {
+	// the second half of the hash of "banner 8" starts with a zero nibble, it's padded to the full length
+	s.Equal("9f8a0fd2c41e467c"+"0eba0477addf1560", ContentHash("banner 8"))
+	s.Len(ContentHash("banner 8"), 32)
+}
+
+func (s *ClientSuite) TestPutBatch() {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(&CustomUint64Converter{}))
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	scans := []Scan{
+		&testData{ip: "10.0.0.2", port: 80, service: "HTTP", timestamp: 100, data: "new"},
+		&testData{ip: "10.0.0.1", port: 22, service: "SSH", timestamp: 100, data: "same"},
+		&testData{ip: "10.0.0.2", port: 22, service: "SSH", timestamp: 100, data: "stale"},
+	}
+	mock.ExpectBegin()
+	// hosts are locked in order, no matter the order of scans
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs("10.0.0.1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs("10.0.0.2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).WithArgs(Hash(scans[0])).
+		WillReturnRows(sqlmock.NewRows([]string{"content_hash", "timestamp"}))
+	mock.ExpectExec("INSERT INTO scan_results *").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO scan_changes .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).WithArgs(Hash(scans[1])).
+		WillReturnRows(sqlmock.NewRows([]string{"content_hash", "timestamp"}).AddRow(ContentHash("same"), 50))
+	mock.ExpectExec(`UPDATE\s+scan_results\s+SET\s+timestamp = \?, fields = \?`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).WithArgs(Hash(scans[2])).
+		WillReturnRows(sqlmock.NewRows([]string{"content_hash", "timestamp"}).AddRow(ContentHash("old"), 150))
+	mock.ExpectExec("UPDATE .* data = .*").WillReturnResult(sqlmock.NewResult(0, 0))
+	// every host rollup is refreshed once
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs("10.0.0.1").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs("10.0.0.2").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	results, err := dbCli.PutBatch(context.TODO(), scans)
+	s.NoError(err)
+	s.Equal([]Result{{Outcome: Inserted}, {Outcome: Unchanged}, {Outcome: Stale}}, results)
+
+	// any failure rolls the whole batch back
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs("10.0.0.1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs("10.0.0.2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).WithArgs(Hash(scans[0])).
+		WillReturnError(fmt.Errorf("database is down"))
+	mock.ExpectRollback()
+
+	results, err = dbCli.PutBatch(context.TODO(), scans)
 	s.Error(err)
-	s.Zero(n)
+	s.Nil(results)
+	s.NoError(mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestPutDetails() {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(&CustomUint64Converter{}))
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	input := (&ScanData{
+		IP: "1.1.1.1", Port: 53, Service: "DNS", Timestamp: 100, Data: "\x12\x34\x81\x80",
+		Details: &scanning.Details{Transport: scanning.TransportUDP, Request: []byte{0x12, 0x34}, LatencyMicros: 800},
+	}).AsScan()
+	// the response hasn't changed, but the details of the latest exchange are still written
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).
+		WithArgs(Hash(input)).
+		WillReturnRows(sqlmock.NewRows([]string{"content_hash", "timestamp"}).AddRow(ContentHash(input.Data()), 50))
+	mock.ExpectExec(`UPDATE\s+scan_results\s+SET\s+timestamp = \?, fields = \?, details = \?`).
+		WithArgs(int64(100), nil, `{"transport":"udp","request":"EjQ=","latency_us":800}`, Hash(input), int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	res, err := dbCli.Put(context.TODO(), input)
+	s.NoError(err)
+	s.Equal(Unchanged, res.Outcome)
+	s.NoError(mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestCharsetOf() {
+	// the known charset is used as it is, otherwise it's detected
+	s.Equal(charset.Latin1, CharsetOf((&ScanData{Data: "caf\xe9", Charset: charset.Latin1}).AsScan()))
+	s.Equal(charset.Latin1, CharsetOf((&ScanData{Data: "caf\xe9"}).AsScan()))
+	s.Equal(charset.UTF8, CharsetOf(&testData{data: "café"}))
 }
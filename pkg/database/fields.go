@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// FindByField - records of the service whose parsed field has the value, e.g. ("HTTP", "header.server", "nginx")
+func (c *Client) FindByField(ctx context.Context, service, field, value string) ([]*ScanData, error) {
+	if field == "" || strings.ContainsAny(field, `"\`) {
+		return nil, fmt.Errorf("invalid field name %q", field)
+	}
+	rows, err := c.db.QueryContext(ctx, getFindByFieldQuery(), service, `$."`+field+`"`, value)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var res []*ScanData
+	for rows.Next() {
+		row, err := scanData(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
+
+// ListRecords - at most limit records of the service (of every service if empty) with hashes greater than after,
+// in hash order, so the whole table can be walked page by page starting with after 0
+func (c *Client) ListRecords(ctx context.Context, service string, after uint64, limit int) ([]*ScanData, error) {
+	query, args := getListRecordsQuery(service, after, limit)
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var res []*ScanData
+	for rows.Next() {
+		row, err := scanData(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
+
+// SetFields - replaces the fields of the record, unless a fresher scan has been written into it since it was read,
+// returns true if the record was changed
+func (c *Client) SetFields(ctx context.Context, row *ScanData, fields map[string]string) (bool, error) {
+	var value sql.NullString
+	if len(fields) > 0 {
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return false, err
+		}
+		value = sql.NullString{String: string(b), Valid: true}
+	}
+	res, err := c.db.ExecContext(ctx, getSetFieldsQuery(), value, row.Hash, row.Timestamp)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+func getFindByFieldQuery() string {
+	return `SELECT ` + scanDataColumns + ` FROM scan_results
+				WHERE service = ? AND JSON_UNQUOTE(JSON_EXTRACT(fields, ?)) = ?
+				ORDER BY timestamp DESC;`
+}
+
+func getListRecordsQuery(service string, after uint64, limit int) (string, []any) {
+	if service == "" {
+		return `SELECT ` + scanDataColumns + ` FROM scan_results WHERE hash > ? ORDER BY hash LIMIT ?;`, []any{after, limit}
+	}
+	return `SELECT ` + scanDataColumns + ` FROM scan_results WHERE hash > ? AND service = ? ORDER BY hash LIMIT ?;`,
+		[]any{after, service, limit}
+}
+
+func getSetFieldsQuery() string {
+	return `UPDATE scan_results SET fields = ? WHERE hash = ? AND timestamp = ?;`
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/igorvan/scan-takehome/pkg/charset"
+)
+
+func (s *ClientSuite) TestPutFields() {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(&CustomUint64Converter{}))
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	input := (&ScanData{
+		IP: "1.1.1.1", Port: 22, Service: "SSH", Timestamp: 100, Data: "SSH-2.0-OpenSSH_9.6",
+		Fields: map[string]string{"proto_version": "2.0", "software": "OpenSSH_9.6"},
+	}).AsScan()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT content_hash, timestamp FROM scan_results WHERE hash = \?;`).
+		WithArgs(Hash(input)).
+		WillReturnRows(sqlmock.NewRows([]string{"content_hash", "timestamp"}))
+	mock.ExpectExec("INSERT INTO scan_results *").WithArgs(Hash(input), "SSH", "1.1.1.1", uint32(22), int64(100),
+		[]byte("SSH-2.0-OpenSSH_9.6"), charset.UTF8, `{"proto_version":"2.0","software":"OpenSSH_9.6"}`, nil, ContentHash("SSH-2.0-OpenSSH_9.6")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO scan_changes .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	res, err := dbCli.Put(context.TODO(), input)
+	s.NoError(err)
+	s.Equal(Inserted, res.Outcome)
+	s.NoError(mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestFindByField() {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(&CustomUint64Converter{}))
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	mock.ExpectQuery(`SELECT hash, service, ip, port, timestamp, data, charset, fields, details, observations FROM scan_results\s+`+
+		`WHERE service = \? AND JSON_UNQUOTE\(JSON_EXTRACT\(fields, \?\)\) = \?\s+ORDER BY timestamp DESC;`).
+		WithArgs("HTTP", `$."header.server"`, "nginx").
+		WillReturnRows(sqlmock.NewRows([]string{"hash", "service", "ip", "port", "timestamp", "data", "charset", "fields", "details", "observations"}).
+			AddRow(1, "HTTP", "1.1.1.1", 80, 100, "HTTP/1.1 200 OK\r\nServer: nginx\r\n\r\n", charset.UTF8,
+				`{"version":"1.1","status_code":"200","reason":"OK","header.server":"nginx"}`, nil, 1))
+	rows, err := dbCli.FindByField(context.TODO(), "HTTP", "header.server", "nginx")
+	s.NoError(err)
+	s.Len(rows, 1)
+	s.Equal("nginx", rows[0].Fields["header.server"])
+	s.Equal("200", rows[0].Fields["status_code"])
+
+	_, err = dbCli.FindByField(context.TODO(), "HTTP", `title") OR 1=1 -- `, "x")
+	s.Error(err)
+	s.NoError(mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestListRecordsAndSetFields() {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(&CustomUint64Converter{}))
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	columns := []string{"hash", "service", "ip", "port", "timestamp", "data", "charset", "fields", "details", "observations"}
+	mock.ExpectQuery(`SELECT hash, .* FROM scan_results WHERE hash > \? ORDER BY hash LIMIT \?;`).
+		WithArgs(uint64(0), 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "SSH", "1.1.1.1", 22, 100, "SSH-2.0-OpenSSH_9.6", charset.UTF8, `{"software":"OpenSSH_9.6"}`, nil, 1).
+			AddRow(2, "HTTP", "1.1.1.1", 80, 100, "HTTP/1.1 200 OK\r\n\r\n", charset.UTF8, nil, nil, 1))
+	rows, err := dbCli.ListRecords(context.TODO(), "", 0, 2)
+	s.NoError(err)
+	s.Require().Len(rows, 2)
+	s.Equal(uint64(2), rows[1].Hash)
+
+	mock.ExpectQuery(`FROM scan_results WHERE hash > \? AND service = \? ORDER BY hash LIMIT \?;`).
+		WithArgs(uint64(1), "SSH", 2).
+		WillReturnRows(sqlmock.NewRows(columns))
+	rows, err = dbCli.ListRecords(context.TODO(), "SSH", 1, 2)
+	s.NoError(err)
+	s.Empty(rows)
+
+	row := &ScanData{Hash: 1, Timestamp: 100}
+	mock.ExpectExec(`UPDATE scan_results SET fields = \? WHERE hash = \? AND timestamp = \?;`).
+		WithArgs(`{"fingerprint.product":"OpenSSH"}`, uint64(1), int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	updated, err := dbCli.SetFields(context.TODO(), row, map[string]string{"fingerprint.product": "OpenSSH"})
+	s.NoError(err)
+	s.True(updated)
+
+	// the record has been rewritten meanwhile
+	mock.ExpectExec(`UPDATE scan_results SET fields = \?`).
+		WithArgs(nil, uint64(1), int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	updated, err = dbCli.SetFields(context.TODO(), row, nil)
+	s.NoError(err)
+	s.False(updated)
+	s.NoError(mock.ExpectationsWereMet())
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrHostNotFound - no scan results stored for the host
+var ErrHostNotFound = errors.New("host not found")
+
+// HostSummary - host-level rollup of the stored scan results
+type HostSummary struct {
+	IP       string   `json:"ip"`
+	Ports    []uint32 `json:"ports"`
+	Services []string `json:"services"`
+	// LastSeen - the most recent scan timestamp among all host services
+	LastSeen int64 `json:"last_seen"`
+	// ServiceCount - number of (port, service) records of the host
+	ServiceCount int `json:"service_count"`
+}
+
+// HostFilter - ListHosts criteria, zero values don't filter anything
+type HostFilter struct {
+	// Port - hosts with this port open, nil matches any
+	Port *uint32
+	// Service - hosts running this service
+	Service string
+	// SeenSince - hosts seen at or after this timestamp
+	SeenSince int64
+	// MinServices - hosts with at least this number of services
+	MinServices int
+	// Limit - maximum number of hosts returned
+	Limit int
+}
+
+// GetHost - returns the rollup of a single host, ErrHostNotFound if nothing is stored for it
+func (c *Client) GetHost(ctx context.Context, ip string) (*HostSummary, error) {
+	row := c.db.QueryRowContext(ctx, getHostSelectQuery()+` WHERE ip = ?;`, ip)
+	host, err := scanHost(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrHostNotFound
+	}
+	return host, err
+}
+
+// ListHosts - returns rollups of hosts matching the filter, the most recently seen hosts first
+func (c *Client) ListHosts(ctx context.Context, filter HostFilter) ([]*HostSummary, error) {
+	if strings.Contains(filter.Service, ",") {
+		return nil, fmt.Errorf("invalid service %q, service names cannot contain commas", filter.Service)
+	}
+	var (
+		conditions = []string{"service_count > 0"}
+		args       []any
+	)
+	if filter.Port != nil {
+		conditions = append(conditions, "FIND_IN_SET(?, ports) > 0")
+		args = append(args, strconv.FormatUint(uint64(*filter.Port), 10))
+	}
+	if filter.Service != "" {
+		conditions = append(conditions, "FIND_IN_SET(?, services) > 0")
+		args = append(args, filter.Service)
+	}
+	if filter.SeenSince > 0 {
+		conditions = append(conditions, "last_seen >= ?")
+		args = append(args, filter.SeenSince)
+	}
+	if filter.MinServices > 0 {
+		conditions = append(conditions, "service_count >= ?")
+		args = append(args, filter.MinServices)
+	}
+	query := getHostSelectQuery() + ` WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY last_seen DESC, ip`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := c.db.QueryContext(ctx, query+`;`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var res []*HostSummary
+	for rows.Next() {
+		host, err := scanHost(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, host)
+	}
+	return res, rows.Err()
+}
+
+// lockHost - takes the host rollup row lock for the rest of the transaction,
+// creates an empty rollup if there was none, returns true in that case
+func lockHost(ctx context.Context, tx *sql.Tx, ip string) (bool, error) {
+	res, err := tx.ExecContext(ctx, getHostLockQuery(), ip)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// refreshHost - recomputes the host rollup from its scan results
+func refreshHost(ctx context.Context, tx *sql.Tx, ip string) error {
+	_, err := tx.ExecContext(ctx, getHostRefreshQuery(), ip)
+	return err
+}
+
+func scanHost(row interface{ Scan(dest ...any) error }) (*HostSummary, error) {
+	var (
+		host     = &HostSummary{}
+		ports    string
+		services string
+	)
+	if err := row.Scan(&host.IP, &ports, &services, &host.LastSeen, &host.ServiceCount); err != nil {
+		return nil, err
+	}
+	for _, p := range strings.Split(ports, ",") {
+		if p == "" {
+			continue
+		}
+		port, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		host.Ports = append(host.Ports, uint32(port))
+	}
+	if services != "" {
+		host.Services = strings.Split(services, ",")
+	}
+	return host, nil
+}
+
+func getHostSelectQuery() string {
+	return `SELECT ip, ports, services, last_seen, service_count FROM host_rollup`
+}
+
+func getHostLockQuery() string {
+	return `INSERT INTO host_rollup (ip, ports, services, last_seen, service_count) VALUES (?, '', '', 0, 0)
+			ON DUPLICATE KEY UPDATE ip = ip;`
+}
+
+// hostListMaxLen - group_concat_max_len of the rollup refresh, the default 1024 bytes silently truncates
+// the port and service lists of hosts with many services, the lists are limited by MEDIUMTEXT columns anyway
+const hostListMaxLen = 16 << 20
+
+func getHostRefreshQuery() string {
+	return `INSERT /*+ SET_VAR(group_concat_max_len = ` + strconv.Itoa(hostListMaxLen) + `) */ INTO host_rollup (ip, ports, services, last_seen, service_count)
+			SELECT * FROM (
+				SELECT
+					ip,
+					GROUP_CONCAT(DISTINCT port ORDER BY port) AS ports,
+					GROUP_CONCAT(DISTINCT service ORDER BY service) AS services,
+					MAX(timestamp) AS last_seen,
+					COUNT(*) AS service_count
+				FROM scan_results
+				WHERE ip = ?
+				GROUP BY ip
+			) AS h
+			ON DUPLICATE KEY UPDATE
+				ports = h.ports, services = h.services, last_seen = h.last_seen, service_count = h.service_count;`
+}
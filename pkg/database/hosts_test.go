@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func (s *ClientSuite) TestGetHost() {
+	mockDB, mock, err := sqlmock.New()
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	columns := []string{"ip", "ports", "services", "last_seen", "service_count"}
+	mock.ExpectQuery(`SELECT ip, ports, services, last_seen, service_count FROM host_rollup WHERE ip = \?;`).
+		WithArgs("1.1.1.1").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("1.1.1.1", "22,80", "HTTP,SSH", 100, 2))
+	host, err := dbCli.GetHost(context.TODO(), "1.1.1.1")
+	s.NoError(err)
+	s.Equal(&HostSummary{IP: "1.1.1.1", Ports: []uint32{22, 80}, Services: []string{"HTTP", "SSH"}, LastSeen: 100, ServiceCount: 2}, host)
+
+	mock.ExpectQuery(`SELECT .* FROM host_rollup WHERE ip = \?;`).
+		WithArgs("1.1.1.2").
+		WillReturnRows(sqlmock.NewRows(columns))
+	host, err = dbCli.GetHost(context.TODO(), "1.1.1.2")
+	s.ErrorIs(err, ErrHostNotFound)
+	s.Nil(host)
+
+	s.NoError(mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestListHosts() {
+	mockDB, mock, err := sqlmock.New()
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	columns := []string{"ip", "ports", "services", "last_seen", "service_count"}
+	port := uint32(443)
+	mock.ExpectQuery(`SELECT .* FROM host_rollup WHERE service_count > 0 AND FIND_IN_SET\(\?, ports\) > 0 AND `+
+		`FIND_IN_SET\(\?, services\) > 0 AND last_seen >= \? AND service_count >= \? ORDER BY last_seen DESC, ip LIMIT \?;`).
+		WithArgs("443", "HTTP", 50, 2, 10).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("1.1.1.1", "80,443", "HTTP", 100, 2).
+			AddRow("1.1.1.2", "443,8443", "HTTP,HTTPS", 90, 3))
+	hosts, err := dbCli.ListHosts(context.TODO(), HostFilter{Port: &port, Service: "HTTP", SeenSince: 50, MinServices: 2, Limit: 10})
+	s.NoError(err)
+	s.Len(hosts, 2)
+	s.Equal([]uint32{443, 8443}, hosts[1].Ports)
+
+	mock.ExpectQuery(`SELECT .* FROM host_rollup WHERE service_count > 0 ORDER BY last_seen DESC, ip;`).
+		WillReturnRows(sqlmock.NewRows(columns))
+	hosts, err = dbCli.ListHosts(context.TODO(), HostFilter{})
+	s.NoError(err)
+	s.Empty(hosts)
+
+	_, err = dbCli.ListHosts(context.TODO(), HostFilter{Service: "HTTP,SSH"})
+	s.Error(err)
+
+	s.NoError(mock.ExpectationsWereMet())
+}
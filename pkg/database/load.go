@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// Loader - storage which is able to write records copied from a backup or another storage as they are
+type Loader interface {
+	Load(ctx context.Context, row *ScanData, overwrite bool) (Result, error)
+}
+
+// Load - writes a record copied from a backup or another storage as it is: unlike Put, its observations are kept
+// and nothing is written into the change log, the stored record is only replaced by a fresher one,
+// or by one as fresh as itself if overwrite is set, the host rollup is kept in sync within the same transaction
+// returns one of Stale, Inserted or Updated outcomes
+func (c *Client) Load(ctx context.Context, row *ScanData, overwrite bool) (Result, error) {
+	var (
+		scan         = row.AsScan()
+		hash         = Hash(scan)
+		contentHash  = ContentHash(row.Data)
+		observations = max(row.Observations, 1)
+		fields       sql.NullString
+		details      sql.NullString
+		storedTime   int64
+	)
+	if len(row.Fields) > 0 {
+		b, err := json.Marshal(row.Fields)
+		if err != nil {
+			return Result{}, err
+		}
+		fields = sql.NullString{String: string(b), Valid: true}
+	}
+	if row.Details != nil {
+		b, err := json.Marshal(row.Details)
+		if err != nil {
+			return Result{}, err
+		}
+		details = sql.NullString{String: string(b), Valid: true}
+	}
+
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	// same lock order as Put - host first, it also keeps the stored timestamp from changing until commit
+	hostCreated, err := lockHost(ctx, tx, row.IP)
+	if err != nil {
+		_ = tx.Rollback()
+		return Result{}, err
+	}
+	outcome := Stale
+	err = tx.QueryRowContext(ctx, getLoadTimestampQuery(), hash).Scan(&storedTime)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		outcome = Inserted
+		_, err = tx.ExecContext(ctx, getLoadInsertQuery(), hash, row.Service, row.IP, row.Port, row.Timestamp,
+			[]byte(row.Data), CharsetOf(scan), fields, details, contentHash, observations)
+	case err != nil:
+		// bad error - fall
+	case storedTime < row.Timestamp || (overwrite && storedTime == row.Timestamp):
+		outcome = Updated
+		_, err = tx.ExecContext(ctx, getLoadUpdateQuery(), row.Timestamp,
+			[]byte(row.Data), CharsetOf(scan), fields, details, contentHash, observations, hash)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return Result{}, err
+	}
+
+	if hostCreated || outcome.Written() {
+		if err := refreshHost(ctx, tx, row.IP); err != nil {
+			_ = tx.Rollback()
+			return Result{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Result{}, err
+	}
+	return Result{Outcome: outcome}, nil
+}
+
+func getLoadTimestampQuery() string {
+	return `SELECT timestamp FROM scan_results WHERE hash = ?;`
+}
+
+func getLoadInsertQuery() string {
+	return `INSERT INTO scan_results (hash, service, ip, port, timestamp, data, charset, fields, details, content_hash, observations)
+				VALUES (?,?,?,?,?,?,?,?,?,?,?);`
+}
+
+func getLoadUpdateQuery() string {
+	return `UPDATE
+				scan_results
+			SET
+				timestamp = ?, data = ?, charset = ?, fields = ?, details = ?, content_hash = ?, observations = ?
+			WHERE
+				hash = ?;`
+}
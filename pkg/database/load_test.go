@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/igorvan/scan-takehome/pkg/charset"
+)
+
+func (s *ClientSuite) TestLoad() {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(&CustomUint64Converter{}))
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	row := &ScanData{IP: "1.1.1.1", Port: 80, Service: "HTTP", Timestamp: 100, Data: "hello", Charset: charset.UTF8,
+		Fields: map[string]string{"status_code": "200"}, Observations: 3}
+	hash := fmt.Sprint(Hash(row.AsScan()))
+
+	// inserted with its observations, nothing goes into the change log
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT timestamp FROM scan_results WHERE hash = \?;`).WithArgs(hash).
+		WillReturnRows(sqlmock.NewRows([]string{"timestamp"}))
+	mock.ExpectExec(`INSERT INTO scan_results`).
+		WithArgs(hash, "HTTP", "1.1.1.1", 80, 100, []byte("hello"), charset.UTF8, `{"status_code":"200"}`, nil, ContentHash("hello"), "3").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	res, err := dbCli.Load(context.TODO(), row, false)
+	s.NoError(err)
+	s.Equal(Inserted, res.Outcome)
+
+	// as fresh as the stored one - only replaced when overwriting
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT timestamp FROM scan_results`).WithArgs(hash).
+		WillReturnRows(sqlmock.NewRows([]string{"timestamp"}).AddRow(100))
+	mock.ExpectCommit()
+	res, err = dbCli.Load(context.TODO(), row, false)
+	s.NoError(err)
+	s.Equal(Stale, res.Outcome)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT timestamp FROM scan_results`).WithArgs(hash).
+		WillReturnRows(sqlmock.NewRows([]string{"timestamp"}).AddRow(100))
+	mock.ExpectExec(`UPDATE\s+scan_results\s+SET\s+timestamp = \?, .* observations = \?\s+WHERE\s+hash = \?;`).
+		WithArgs(100, []byte("hello"), charset.UTF8, `{"status_code":"200"}`, nil, ContentHash("hello"), "3", hash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	res, err = dbCli.Load(context.TODO(), row, true)
+	s.NoError(err)
+	s.Equal(Updated, res.Outcome)
+
+	// a fresher stored record is never overwritten
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT timestamp FROM scan_results`).WithArgs(hash).
+		WillReturnRows(sqlmock.NewRows([]string{"timestamp"}).AddRow(200))
+	mock.ExpectCommit()
+	res, err = dbCli.Load(context.TODO(), row, true)
+	s.NoError(err)
+	s.Equal(Stale, res.Outcome)
+
+	s.NoError(mock.ExpectationsWereMet())
+}
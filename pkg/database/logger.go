@@ -11,12 +11,17 @@ type NullSafeLogger struct {
 	log Logger
 }
 
+// NewNullSafeLogger - NullSafeLogger constructor
+func NewNullSafeLogger(log Logger) *NullSafeLogger {
+	return &NullSafeLogger{log}
+}
+
 // Error - logging wrapper
 func (l *NullSafeLogger) Error(msg string, args ...any) {
 	if l.log == nil {
 		return
 	}
-	l.Error(msg, args...)
+	l.log.Error(msg, args...)
 }
 
 // Info - logging wrapper
@@ -24,5 +29,5 @@ func (l *NullSafeLogger) Info(msg string, args ...any) {
 	if l.log == nil {
 		return
 	}
-	l.Info(msg, args...)
+	l.log.Info(msg, args...)
 }
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"strconv"
+)
+
+// migration - schema change of a database created by an older db_init/scan_results.sql,
+// fresh databases are created with the current schema and have every migration in place
+type migration struct {
+	name string
+	// check - query counting what the migration creates, the migration is in place if it's not 0
+	check     string
+	checkArgs []any
+	apply     []string
+}
+
+// Migrate - brings the schema of an existing database up to date (see db_init/scan_results.sql),
+// returns the names of the applied migrations, the ones already in place are skipped, so it can be run any number of times
+func (c *Client) Migrate(ctx context.Context) ([]string, error) {
+	var applied []string
+	for _, m := range migrations() {
+		var count int
+		if err := c.db.QueryRowContext(ctx, m.check, m.checkArgs...).Scan(&count); err != nil {
+			return applied, err
+		}
+		if count > 0 {
+			continue
+		}
+		c.log.Info("applying schema migration " + m.name)
+		for _, stmt := range m.apply {
+			if _, err := c.db.ExecContext(ctx, stmt); err != nil {
+				return applied, err
+			}
+		}
+		applied = append(applied, m.name)
+	}
+	return applied, nil
+}
+
+// migrations - schema changes in the order they were made
+func migrations() []migration {
+	return []migration{
+		{
+			name:  "scan_results indexes",
+			check: getIndexCheckQuery(), checkArgs: []any{"scan_results", "idx_timestamp"},
+			apply: []string{`ALTER TABLE scan_results
+				ADD INDEX idx_service (service), ADD INDEX idx_ip (ip), ADD INDEX idx_port (port), ADD INDEX idx_timestamp (timestamp);`},
+		},
+		{
+			name:  "host_rollup table",
+			check: getTableCheckQuery(), checkArgs: []any{"host_rollup"},
+			apply: []string{`CREATE TABLE host_rollup (
+				ip VARCHAR(64) PRIMARY KEY,
+				ports TEXT NOT NULL,
+				services TEXT NOT NULL,
+				last_seen INT UNSIGNED NOT NULL,
+				service_count INT NOT NULL,
+				INDEX idx_last_seen (last_seen),
+				INDEX idx_service_count (service_count)
+			);`, getHostRollupFillQuery()},
+		},
+		{
+			name:  "scan_quarantine table",
+			check: getTableCheckQuery(), checkArgs: []any{"scan_quarantine"},
+			apply: []string{`CREATE TABLE scan_quarantine (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				service VARCHAR(255) NOT NULL,
+				ip VARCHAR(255) NOT NULL,
+				port BIGINT NOT NULL,
+				timestamp BIGINT NOT NULL,
+				data VARCHAR(255),
+				reason VARCHAR(64) NOT NULL,
+				quarantined_at INT UNSIGNED NOT NULL,
+				INDEX idx_reason (reason)
+			);`},
+		},
+		{
+			name:  "scan_results raw data and charset",
+			check: getColumnCheckQuery(), checkArgs: []any{"scan_results", "charset", "varchar"},
+			apply: []string{`ALTER TABLE scan_results MODIFY data MEDIUMBLOB, ADD COLUMN charset VARCHAR(16) NOT NULL DEFAULT 'utf-8' AFTER data;`},
+		},
+		{
+			name:  "scan_quarantine raw data",
+			check: getColumnCheckQuery(), checkArgs: []any{"scan_quarantine", "data", "mediumblob"},
+			apply: []string{`ALTER TABLE scan_quarantine MODIFY data MEDIUMBLOB;`},
+		},
+		{
+			name:  "scan_results fields",
+			check: getColumnCheckQuery(), checkArgs: []any{"scan_results", "fields", "json"},
+			apply: []string{`ALTER TABLE scan_results ADD COLUMN fields JSON AFTER charset;`},
+		},
+		{
+			name:  "scan_results content hash and observations",
+			check: getColumnCheckQuery(), checkArgs: []any{"scan_results", "observations", "int"},
+			// records without content hash are rewritten once on their next update
+			apply: []string{`ALTER TABLE scan_results
+				ADD COLUMN content_hash CHAR(32) AFTER fields, ADD COLUMN observations INT UNSIGNED NOT NULL DEFAULT 1 AFTER content_hash;`},
+		},
+		{
+			name:  "scan_results details",
+			check: getColumnCheckQuery(), checkArgs: []any{"scan_results", "details", "json"},
+			apply: []string{`ALTER TABLE scan_results ADD COLUMN details JSON AFTER fields;`},
+		},
+		{
+			name:  "scan_changes table",
+			check: getTableCheckQuery(), checkArgs: []any{"scan_changes"},
+			apply: []string{`CREATE TABLE scan_changes (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				hash BIGINT UNSIGNED NOT NULL,
+				service VARCHAR(255) NOT NULL,
+				ip VARCHAR(64) NOT NULL,
+				port INT NOT NULL,
+				timestamp INT UNSIGNED NOT NULL,
+				previous_timestamp INT UNSIGNED,
+				kind VARCHAR(16) NOT NULL,
+				content_hash CHAR(32),
+				INDEX idx_hash (hash),
+				INDEX idx_ip (ip),
+				INDEX idx_timestamp (timestamp),
+				INDEX idx_kind_timestamp (kind, timestamp)
+			);`},
+		},
+		{
+			name:  "host_rollup long lists",
+			check: getColumnCheckQuery(), checkArgs: []any{"host_rollup", "services", "mediumtext"},
+			// lists truncated by the former TEXT columns are rebuilt
+			apply: []string{`ALTER TABLE host_rollup MODIFY ports MEDIUMTEXT NOT NULL, MODIFY services MEDIUMTEXT NOT NULL;`,
+				getHostRollupFillQuery()},
+		},
+	}
+}
+
+func getTableCheckQuery() string {
+	return `SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?;`
+}
+
+func getColumnCheckQuery() string {
+	return `SELECT COUNT(*) FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ? AND DATA_TYPE = ?;`
+}
+
+func getIndexCheckQuery() string {
+	return `SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?;`
+}
+
+// getHostRollupFillQuery - rebuilds the rollup of every host, see getHostRefreshQuery
+func getHostRollupFillQuery() string {
+	return `INSERT /*+ SET_VAR(group_concat_max_len = ` + strconv.Itoa(hostListMaxLen) + `) */ INTO host_rollup (ip, ports, services, last_seen, service_count)
+			SELECT * FROM (
+				SELECT
+					ip,
+					GROUP_CONCAT(DISTINCT port ORDER BY port) AS ports,
+					GROUP_CONCAT(DISTINCT service ORDER BY service) AS services,
+					MAX(timestamp) AS last_seen,
+					COUNT(*) AS service_count
+				FROM scan_results
+				GROUP BY ip
+			) AS h
+			ON DUPLICATE KEY UPDATE
+				ports = h.ports, services = h.services, last_seen = h.last_seen, service_count = h.service_count;`
+}
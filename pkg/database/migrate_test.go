@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func (s *ClientSuite) TestMigrate() {
+	mockDB, mock, err := sqlmock.New()
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	// the baseline schema, every migration is applied
+	for _, m := range migrations() {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM information_schema`).WithArgs(toDriverArgs(m.checkArgs)...).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		for range m.apply {
+			mock.ExpectExec(`ALTER TABLE|CREATE TABLE|INSERT .*INTO host_rollup`).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+	}
+	applied, err := dbCli.Migrate(context.TODO())
+	s.NoError(err)
+	s.Equal([]string{
+		"scan_results indexes", "host_rollup table", "scan_quarantine table", "scan_results raw data and charset",
+		"scan_quarantine raw data", "scan_results fields", "scan_results content hash and observations", "scan_results details",
+		"scan_changes table", "host_rollup long lists",
+	}, applied)
+	s.NoError(mock.ExpectationsWereMet())
+
+	// only the latest change is missing, a failure stops the migration
+	all := migrations()
+	for _, m := range all[:len(all)-1] {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM information_schema`).WithArgs(toDriverArgs(m.checkArgs)...).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	}
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM information_schema`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`ALTER TABLE|CREATE TABLE`).WillReturnError(fmt.Errorf("access denied"))
+	applied, err = dbCli.Migrate(context.TODO())
+	s.Error(err)
+	s.Empty(applied)
+	s.NoError(mock.ExpectationsWereMet())
+
+	// up to date schema is left as it is
+	for _, m := range migrations() {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM information_schema`).WithArgs(toDriverArgs(m.checkArgs)...).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	}
+	applied, err = dbCli.Migrate(context.TODO())
+	s.NoError(err)
+	s.Empty(applied)
+	s.NoError(mock.ExpectationsWereMet())
+}
+
+func toDriverArgs(args []any) []driver.Value {
+	res := make([]driver.Value, 0, len(args))
+	for _, arg := range args {
+		res = append(res, arg)
+	}
+	return res
+}
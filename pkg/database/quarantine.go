@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// quarantineTextLen - length of the service and ip columns of scan_quarantine
+const quarantineTextLen = 255
+
+// QuarantinedScan - rejected scan kept for later inspection
+type QuarantinedScan struct {
+	ScanData
+	ID     int64  `sql:"id"`
+	Reason string `sql:"reason"`
+	// QuarantinedAt - when the scan was rejected
+	QuarantinedAt int64 `sql:"quarantined_at"`
+}
+
+// Quarantine - stores a rejected scan along with the rejection reason
+// service and IP are cut to the length of their columns (and invalid UTF-8 is replaced), scans are often rejected
+// for them, a scan which doesn't fit into the quarantine would otherwise fail to be quarantined on every redelivery
+func (c *Client) Quarantine(ctx context.Context, scan Scan, reason string) error {
+	_, err := c.db.ExecContext(ctx, getQuarantineInsertQuery(), quarantineText(scan.Service()), quarantineText(scan.IP()),
+		scan.Port(), scan.Timestamp(), scan.Data(), reason, time.Now().Unix())
+	return err
+}
+
+// quarantineText - s made fit into a quarantineTextLen characters long column, cut on a rune boundary
+func quarantineText(s string) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if len(s) <= quarantineTextLen {
+		return s
+	}
+	n := quarantineTextLen
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// GetQuarantined - returns up to limit most recently quarantined scans
+func (c *Client) GetQuarantined(ctx context.Context, limit int) ([]*QuarantinedScan, error) {
+	rows, err := c.db.QueryContext(ctx, getQuarantineSelectQuery(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var res []*QuarantinedScan
+	for rows.Next() {
+		row := &QuarantinedScan{}
+		if err := rows.Scan(&row.ID, &row.Service, &row.IP, &row.Port, &row.Timestamp, &row.Data,
+			&row.Reason, &row.QuarantinedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
+
+func getQuarantineInsertQuery() string {
+	return `INSERT INTO scan_quarantine (service, ip, port, timestamp, data, reason, quarantined_at) VALUES (?,?,?,?,?,?,?);`
+}
+
+func getQuarantineSelectQuery() string {
+	return `SELECT id, service, ip, port, timestamp, data, reason, quarantined_at FROM scan_quarantine ORDER BY id DESC LIMIT ?;`
+}
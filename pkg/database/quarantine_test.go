@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func (s *ClientSuite) TestQuarantine() {
+	mockDB, mock, err := sqlmock.New()
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	input := &testData{ip: "not an ip", port: 80, service: "HTTP", timestamp: 100, data: "hello"}
+	mock.ExpectExec(`INSERT INTO scan_quarantine`).
+		WithArgs("HTTP", "not an ip", uint32(80), int64(100), "hello", "invalid_ip", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.NoError(dbCli.Quarantine(context.TODO(), input, "invalid_ip"))
+
+	mock.ExpectQuery(`SELECT id, service, ip, port, timestamp, data, reason, quarantined_at FROM scan_quarantine ORDER BY id DESC LIMIT \?;`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "service", "ip", "port", "timestamp", "data", "reason", "quarantined_at"}).
+			AddRow(1, "HTTP", "not an ip", 80, 100, "hello", "invalid_ip", 200))
+	rows, err := dbCli.GetQuarantined(context.TODO(), 10)
+	s.NoError(err)
+	s.Len(rows, 1)
+	s.Equal("invalid_ip", rows[0].Reason)
+	s.Equal("not an ip", rows[0].IP)
+
+	s.NoError(mock.ExpectationsWereMet())
+}
+
+func (s *ClientSuite) TestQuarantineOversized() {
+	mockDB, mock, err := sqlmock.New()
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	// the column would reject both, and the scan would never make it into the quarantine
+	input := &testData{ip: strings.Repeat("1.", 200), port: 80, service: strings.Repeat("é", 200) + "\xff", timestamp: 100, data: "hello"}
+	mock.ExpectExec(`INSERT INTO scan_quarantine`).
+		WithArgs(strings.Repeat("é", 127), strings.Repeat("1.", 127)+"1", uint32(80), int64(100), "hello", "invalid_ip", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.NoError(dbCli.Quarantine(context.TODO(), input, "invalid_ip"))
+
+	s.Equal("HTTP\uFFFD", quarantineText("HTTP\xff"))
+	s.NoError(mock.ExpectationsWereMet())
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// FindFuture - records with timestamps after the provided one, e.g. written by scanners with bad clocks
+func (c *Client) FindFuture(ctx context.Context, after int64) ([]*ScanData, error) {
+	rows, err := c.db.QueryContext(ctx, getFindFutureQuery(), after)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var res []*ScanData
+	for rows.Next() {
+		row, err := scanData(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
+
+// ClampTimestamp - moves the record timestamp back to timestamp, unless a concurrent write has already
+// brought it back to or before after, returns true if the record was changed
+func (c *Client) ClampTimestamp(ctx context.Context, row *ScanData, after, timestamp int64) (bool, error) {
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// same lock order as Put - host first
+	if _, err := lockHost(ctx, tx, row.IP); err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+	res, err := tx.ExecContext(ctx, getClampQuery(), timestamp, row.Hash, after)
+	if err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected > 0 {
+		if err := refreshHost(ctx, tx, row.IP); err != nil {
+			_ = tx.Rollback()
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+func getFindFutureQuery() string {
+	return `SELECT ` + scanDataColumns + ` FROM scan_results WHERE timestamp > ? ORDER BY timestamp DESC;`
+}
+
+func getClampQuery() string {
+	return `UPDATE scan_results SET timestamp = ? WHERE hash = ? AND timestamp > ?;`
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func (s *ClientSuite) TestFindFutureAndClamp() {
+	mockDB, mock, err := sqlmock.New(sqlmock.ValueConverterOption(&CustomUint64Converter{}))
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	mock.ExpectQuery(`SELECT hash, service, ip, port, timestamp, data, charset, fields, details, observations FROM scan_results WHERE timestamp > \? ORDER BY timestamp DESC;`).
+		WithArgs(1000).
+		WillReturnRows(sqlmock.NewRows([]string{"hash", "service", "ip", "port", "timestamp", "data", "charset", "fields", "details", "observations"}).
+			AddRow(1, "HTTP", "1.1.1.1", 80, 99999, "from the future", "utf-8", nil, nil, 1))
+	rows, err := dbCli.FindFuture(context.TODO(), 1000)
+	s.NoError(err)
+	s.Len(rows, 1)
+
+	// clamped
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE scan_results SET timestamp = \? WHERE hash = \? AND timestamp > \?;`).
+		WithArgs(900, fmt.Sprint(rows[0].Hash), 1000).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT .*INTO host_rollup .* SELECT").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	changed, err := dbCli.ClampTimestamp(context.TODO(), rows[0], 1000, 900)
+	s.NoError(err)
+	s.True(changed)
+
+	// already fixed by a concurrent write
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO host_rollup .* ON DUPLICATE KEY UPDATE ip = ip;").WithArgs("1.1.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE scan_results SET timestamp = \?`).
+		WithArgs(900, fmt.Sprint(rows[0].Hash), 1000).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	changed, err = dbCli.ClampTimestamp(context.TODO(), rows[0], 1000, 900)
+	s.NoError(err)
+	s.False(changed)
+
+	s.NoError(mock.ExpectationsWereMet())
+}
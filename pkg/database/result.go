@@ -0,0 +1,74 @@
+package database
+
+import "fmt"
+
+// Outcome - what happened to a scan on its way into the storage
+type Outcome uint8
+
+// Outcomes
+const (
+	// Unknown - no outcome, the scan failed to be processed (the error tells why)
+	Unknown Outcome = iota
+	// Inserted - it's the first scan of the service, new record was created
+	Inserted
+	// Updated - the stored scan was replaced with a fresher one with a different response
+	Updated
+	// Unchanged - the fresher scan has the same response as the stored one,
+	// only its timestamp (and observation count) was advanced
+	Unchanged
+	// Stale - the stored scan is not older than the provided one, nothing was written
+	Stale
+	// Reappeared - the fresher scan is the first one since the record expired (see WithExpiry),
+	// it's written just like Updated or Unchanged, whichever applies
+	Reappeared
+	// Rejected - the scan never reached the storage, Result.Reason tells why
+	Rejected
+)
+
+var outcomeNames = [...]string{
+	Unknown:    "unknown",
+	Inserted:   "inserted",
+	Updated:    "updated",
+	Unchanged:  "unchanged",
+	Stale:      "stale",
+	Reappeared: "reappeared",
+	Rejected:   "rejected",
+}
+
+// String - outcome name
+func (o Outcome) String() string {
+	if int(o) < len(outcomeNames) {
+		return outcomeNames[o]
+	}
+	return fmt.Sprintf("outcome(%d)", o)
+}
+
+// Written - true if the record was written, i.e. the scan was neither stale nor rejected
+func (o Outcome) Written() bool {
+	return o == Inserted || o == Updated || o == Unchanged || o == Reappeared
+}
+
+// Result - result of storing a scan, returned by every storage and by processing.Receiver
+type Result struct {
+	Outcome Outcome
+	// Reason - why the scan was rejected, empty unless Outcome is Rejected
+	Reason string
+}
+
+// Rejection - Rejected result with the reason
+func Rejection(reason string) Result {
+	return Result{Outcome: Rejected, Reason: reason}
+}
+
+// String - outcome name, followed by the reason for rejected scans
+func (r Result) String() string {
+	if r.Outcome == Rejected && r.Reason != "" {
+		return r.Outcome.String() + ": " + r.Reason
+	}
+	return r.Outcome.String()
+}
+
+// Change - the change the result represents, see Change
+func (r Result) Change() Change {
+	return ChangeOf(r.Outcome)
+}
@@ -1,11 +1,127 @@
 package database
 
+import (
+	"github.com/igorvan/scan-takehome/pkg/charset"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
 // ScanData - database table data representation
 type ScanData struct {
 	IP        string `sql:"ip"`
 	Port      uint32 `sql:"port"`
 	Service   string `sql:"service"`
 	Timestamp int64  `sql:"timestamp"`
-	Data      string `sql:"data"`
-	Hash      uint64 `sql:"hash"`
+	// Data - service response exactly as it was received, not necessarily valid UTF-8
+	Data string `sql:"data"`
+	// Charset - detected charset of Data, see package charset
+	Charset string `sql:"charset"`
+	// Fields - structured fields parsed from Data, nil if the response wasn't parsed
+	Fields map[string]string `sql:"fields"`
+	// Details - details of the latest scanner exchange with the service, nil for data versions without them
+	Details *scanning.Details `sql:"details"`
+	// Observations - number of scans which have been stored (or found unchanged) in the record
+	Observations uint64 `sql:"observations"`
+	Hash         uint64 `sql:"hash"`
+}
+
+// ParsedScan - Scan with structured fields parsed from its response
+type ParsedScan interface {
+	Scan
+	Fields() map[string]string
+}
+
+// FieldsOf - structured fields of the scan, nil unless it's a ParsedScan
+func FieldsOf(scan Scan) map[string]string {
+	if parsed, ok := scan.(ParsedScan); ok {
+		return parsed.Fields()
+	}
+	return nil
+}
+
+// CharsetScan - Scan which knows the charset of its response
+type CharsetScan interface {
+	Scan
+	Charset() string
+}
+
+// CharsetOf - charset of the scan response, detected unless the scan is a CharsetScan which knows it
+func CharsetOf(scan Scan) string {
+	if cs, ok := scan.(CharsetScan); ok && cs.Charset() != "" {
+		return cs.Charset()
+	}
+	return charset.Detect([]byte(scan.Data()))
+}
+
+// DetailedScan - Scan with the details of the scanner's exchange with the service
+type DetailedScan interface {
+	Scan
+	Details() *scanning.Details
+}
+
+// DetailsOf - details of the scan, nil unless it's a DetailedScan
+func DetailsOf(scan Scan) *scanning.Details {
+	if detailed, ok := scan.(DetailedScan); ok {
+		return detailed.Details()
+	}
+	return nil
+}
+
+// Raw - service response bytes exactly as they were received
+func (s *ScanData) Raw() []byte {
+	return []byte(s.Data)
+}
+
+// Display - service response safe to print or log, decoded using its charset with unprintable bytes escaped
+func (s *ScanData) Display() string {
+	return charset.Display([]byte(s.Data), s.Charset)
+}
+
+// AsScan - returns the stored record as a Scan, so it can be written into another storage
+func (s *ScanData) AsScan() Scan {
+	return &storedScan{s}
+}
+
+// storedScan - Scan view of ScanData
+type storedScan struct {
+	row *ScanData
+}
+
+// IP - scanned service IP address
+func (s *storedScan) IP() string {
+	return s.row.IP
+}
+
+// Port - scanned service port
+func (s *storedScan) Port() uint32 {
+	return s.row.Port
+}
+
+// Service - scanned service name
+func (s *storedScan) Service() string {
+	return s.row.Service
+}
+
+// Timestamp - the timestamp of the scanning
+func (s *storedScan) Timestamp() int64 {
+	return s.row.Timestamp
+}
+
+// Data - scanned service response
+func (s *storedScan) Data() string {
+	return s.row.Data
+}
+
+// Charset - stored charset of the response
+func (s *storedScan) Charset() string {
+	return s.row.Charset
+}
+
+// Fields - structured fields parsed from the response
+func (s *storedScan) Fields() map[string]string {
+	return s.row.Fields
+}
+
+// Details - details of the scanner's exchange with the service
+func (s *storedScan) Details() *scanning.Details {
+	return s.row.Details
 }
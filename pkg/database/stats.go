@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	secondsPerDay = 24 * 60 * 60
+	dayLayout     = "2006-01-02"
+)
+
+// Aggregator - storage which is able to compute aggregate statistics over stored scan results
+type Aggregator interface {
+	CountByService(ctx context.Context) ([]ServiceCount, error)
+	TopPorts(ctx context.Context, limit int) ([]PortCount, error)
+	CountHosts(ctx context.Context) (int64, error)
+	CountByDay(ctx context.Context) ([]DayCount, error)
+}
+
+// ServiceCount - number of records of a service
+type ServiceCount struct {
+	Service string `json:"service"`
+	Count   int64  `json:"count"`
+}
+
+// PortCount - number of records on a port
+type PortCount struct {
+	Port  uint32 `json:"port"`
+	Count int64  `json:"count"`
+}
+
+// DayCount - number of records last scanned on a day (UTC, YYYY-MM-DD)
+type DayCount struct {
+	Day   string `json:"day"`
+	Count int64  `json:"count"`
+}
+
+// DayOf - UTC day of a scan timestamp, the same day format is used by every Aggregator
+func DayOf(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format(dayLayout)
+}
+
+// CountByService - number of records per service, the most popular services first
+func (c *Client) CountByService(ctx context.Context) ([]ServiceCount, error) {
+	rows, err := c.db.QueryContext(ctx, getCountByServiceQuery())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var res []ServiceCount
+	for rows.Next() {
+		var row ServiceCount
+		if err := rows.Scan(&row.Service, &row.Count); err != nil {
+			return nil, err
+		}
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
+
+// TopPorts - the limit ports with the most records, limit must be positive
+func (c *Client) TopPorts(ctx context.Context, limit int) ([]PortCount, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid top ports limit %d", limit)
+	}
+	rows, err := c.db.QueryContext(ctx, getTopPortsQuery(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var res []PortCount
+	for rows.Next() {
+		var row PortCount
+		if err := rows.Scan(&row.Port, &row.Count); err != nil {
+			return nil, err
+		}
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
+
+// CountHosts - number of distinct IP addresses
+func (c *Client) CountHosts(ctx context.Context) (int64, error) {
+	var n int64
+	err := c.db.QueryRowContext(ctx, getCountHostsQuery()).Scan(&n)
+	return n, err
+}
+
+// CountByDay - number of records per last scanned day, in chronological order
+func (c *Client) CountByDay(ctx context.Context) ([]DayCount, error) {
+	rows, err := c.db.QueryContext(ctx, getCountByDayQuery())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var res []DayCount
+	for rows.Next() {
+		var (
+			day   int64
+			count int64
+		)
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		res = append(res, DayCount{Day: DayOf(day * secondsPerDay), Count: count})
+	}
+	return res, rows.Err()
+}
+
+func getCountByServiceQuery() string {
+	return `SELECT service, COUNT(*) AS n FROM scan_results GROUP BY service ORDER BY n DESC, service;`
+}
+
+func getTopPortsQuery() string {
+	return `SELECT port, COUNT(*) AS n FROM scan_results GROUP BY port ORDER BY n DESC, port LIMIT ?;`
+}
+
+func getCountHostsQuery() string {
+	return `SELECT COUNT(DISTINCT ip) FROM scan_results;`
+}
+
+func getCountByDayQuery() string {
+	// integer division keeps days in UTC regardless of the session time zone
+	return `SELECT timestamp DIV 86400 AS day, COUNT(*) FROM scan_results GROUP BY day ORDER BY day;`
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func (s *ClientSuite) TestAggregates() {
+	mockDB, mock, err := sqlmock.New()
+	s.NoError(err)
+	dbCli, err := New(mockDB, nil)
+	s.NoError(err)
+
+	mock.ExpectQuery(`SELECT service, COUNT\(\*\) AS n FROM scan_results GROUP BY service`).
+		WillReturnRows(sqlmock.NewRows([]string{"service", "n"}).AddRow("HTTP", 10).AddRow("SSH", 3))
+	services, err := dbCli.CountByService(context.TODO())
+	s.NoError(err)
+	s.Equal([]ServiceCount{{Service: "HTTP", Count: 10}, {Service: "SSH", Count: 3}}, services)
+
+	mock.ExpectQuery(`SELECT port, COUNT\(\*\) AS n FROM scan_results GROUP BY port ORDER BY n DESC, port LIMIT \?;`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"port", "n"}).AddRow(443, 7).AddRow(22, 3))
+	ports, err := dbCli.TopPorts(context.TODO(), 2)
+	s.NoError(err)
+	s.Equal([]PortCount{{Port: 443, Count: 7}, {Port: 22, Count: 3}}, ports)
+	_, err = dbCli.TopPorts(context.TODO(), -1)
+	s.Error(err)
+
+	mock.ExpectQuery(`SELECT COUNT\(DISTINCT ip\) FROM scan_results;`).
+		WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(42))
+	hosts, err := dbCli.CountHosts(context.TODO())
+	s.NoError(err)
+	s.Equal(int64(42), hosts)
+
+	mock.ExpectQuery(`SELECT timestamp DIV 86400 AS day, COUNT\(\*\) FROM scan_results GROUP BY day ORDER BY day;`).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "n"}).AddRow(0, 1).AddRow(20000, 5))
+	days, err := dbCli.CountByDay(context.TODO())
+	s.NoError(err)
+	s.Equal([]DayCount{{Day: "1970-01-01", Count: 1}, {Day: "2024-10-04", Count: 5}}, days)
+
+	s.NoError(mock.ExpectationsWereMet())
+}
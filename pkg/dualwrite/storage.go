@@ -0,0 +1,169 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/processing"
+)
+
+const (
+	defaultQueueSize     = 1024
+	defaultRetryInterval = time.Second
+	retryWriteTimeout    = 10 * time.Second
+)
+
+// Policy - defines what happens when a write into the secondary storage fails
+type Policy uint8
+
+const (
+	// PolicyLog - secondary failures are logged and otherwise ignored
+	PolicyLog Policy = iota
+	// PolicyRetry - failed secondary writes are queued in memory and retried in background (see Storage.Run),
+	// the messages are acked meanwhile, so the writes still queued when the process stops are lost
+	// and the secondary storage has to be repaired by the verifier
+	PolicyRetry
+	// PolicyFail - secondary failure fails the whole Put, so the message is redelivered
+	PolicyFail
+)
+
+// ParsePolicy - converts a policy name (log, retry, fail) into Policy
+func ParsePolicy(name string) (Policy, error) {
+	switch name {
+	case "log":
+		return PolicyLog, nil
+	case "retry":
+		return PolicyRetry, nil
+	case "fail":
+		return PolicyFail, nil
+	default:
+		return 0, fmt.Errorf("unknown dual-write policy %q", name)
+	}
+}
+
+// Storage - writes every scan into the primary storage and then mirrors it into the secondary one,
+// the primary storage always stays the source of truth for the Put result
+type Storage struct {
+	primary       processing.Storage
+	secondary     processing.Storage
+	policy        Policy
+	log           database.Logger
+	queue         chan database.Scan
+	retryInterval time.Duration
+	failures      atomic.Uint64
+}
+
+// New - Storage constructor
+func New(primary, secondary processing.Storage, policy Policy, log database.Logger) (*Storage, error) {
+	if primary == nil || secondary == nil {
+		return nil, fmt.Errorf("cannot instantiate dual-write Storage, both primary and secondary storages are required")
+	}
+	if policy > PolicyFail {
+		return nil, fmt.Errorf("cannot instantiate dual-write Storage, unknown policy %d", policy)
+	}
+	s := &Storage{
+		primary:       primary,
+		secondary:     secondary,
+		policy:        policy,
+		log:           database.NewNullSafeLogger(log),
+		retryInterval: defaultRetryInterval,
+	}
+	if policy == PolicyRetry {
+		s.queue = make(chan database.Scan, defaultQueueSize)
+	}
+	return s, nil
+}
+
+// Put - writes the scan into both storages, returns the primary storage result
+func (s *Storage) Put(ctx context.Context, scan database.Scan) (database.Result, error) {
+	res, err := s.primary.Put(ctx, scan)
+	if err != nil {
+		// nothing was written into the source of truth - don't touch the secondary either,
+		// the message is going to be redelivered anyway
+		return database.Result{}, err
+	}
+
+	if _, err := s.secondary.Put(ctx, scan); err != nil {
+		s.failures.Add(1)
+		switch s.policy {
+		case PolicyFail:
+			return database.Result{}, fmt.Errorf("secondary storage write failed: %w", err)
+		case PolicyRetry:
+			select {
+			case s.queue <- scan:
+				s.log.Error(fmt.Sprintf("secondary storage write failed, queued for retry [Service: %s, IP: %s, Port: %d]: %s",
+					scan.Service(), scan.IP(), scan.Port(), err))
+			default:
+				// the retry queue is full - the only way not to lose the scan is to fail and rely on redelivery
+				return database.Result{}, fmt.Errorf("secondary storage write failed and retry queue is full: %w", err)
+			}
+		default:
+			s.log.Error(fmt.Sprintf("secondary storage write failed [Service: %s, IP: %s, Port: %d]: %s",
+				scan.Service(), scan.IP(), scan.Port(), err))
+		}
+	}
+	return res, nil
+}
+
+// Run - retries queued secondary writes until the context is cancelled, a no-op unless PolicyRetry is used,
+// the writes left in the queue are reported as lost when it returns
+func (s *Storage) Run(ctx context.Context) {
+	if s.queue == nil {
+		return
+	}
+	defer s.reportPending()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case scan := <-s.queue:
+			if s.retry(ctx, scan) {
+				continue
+			}
+			// put it back to the end of the queue and give the secondary storage some rest
+			select {
+			case s.queue <- scan:
+			default:
+				s.log.Error(fmt.Sprintf("secondary storage retry queue is full, dropping [Service: %s, IP: %s, Port: %d]",
+					scan.Service(), scan.IP(), scan.Port()))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.retryInterval):
+			}
+		}
+	}
+}
+
+// Pending - number of secondary writes waiting for retry
+func (s *Storage) Pending() int {
+	return len(s.queue)
+}
+
+// Failures - total number of failed secondary writes
+func (s *Storage) Failures() uint64 {
+	return s.failures.Load()
+}
+
+// reportPending - logs the queued writes which are never going to be retried
+func (s *Storage) reportPending() {
+	if pending := s.Pending(); pending > 0 {
+		s.log.Error(fmt.Sprintf("dual-write is stopped with %d secondary writes pending retry, they are lost, "+
+			"the secondary storage has to be repaired by the verifier", pending))
+	}
+}
+
+func (s *Storage) retry(ctx context.Context, scan database.Scan) bool {
+	retryCtx, cancel := context.WithTimeout(ctx, retryWriteTimeout)
+	defer cancel()
+	if _, err := s.secondary.Put(retryCtx, scan); err != nil {
+		s.log.Error(fmt.Sprintf("secondary storage retry failed [Service: %s, IP: %s, Port: %d]: %s",
+			scan.Service(), scan.IP(), scan.Port(), err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/memory"
+)
+
+type failingStorage struct {
+	*memory.Store
+	fail atomic.Bool
+}
+
+func (f *failingStorage) Put(ctx context.Context, scan database.Scan) (database.Result, error) {
+	if f.fail.Load() {
+		return database.Result{}, fmt.Errorf("secondary is down")
+	}
+	return f.Store.Put(ctx, scan)
+}
+
+func scanData(ip string, ts int64, data string) *database.ScanData {
+	return &database.ScanData{IP: ip, Port: 80, Service: "HTTP", Timestamp: ts, Data: data}
+}
+
+type DualWriteSuite struct {
+	suite.Suite
+}
+
+func TestDualWriteSuite(t *testing.T) {
+	suite.Run(t, &DualWriteSuite{})
+}
+
+func (s *DualWriteSuite) TestNew() {
+	_, err := New(nil, memory.New(), PolicyLog, nil)
+	s.Error(err)
+	_, err = New(memory.New(), memory.New(), Policy(42), nil)
+	s.Error(err)
+	st, err := New(memory.New(), memory.New(), PolicyRetry, nil)
+	s.NoError(err)
+	s.NotNil(st)
+}
+
+func (s *DualWriteSuite) TestPut() {
+	scan := scanData("1.1.1.1", 100, "hello").AsScan()
+	testCases := []struct {
+		title           string
+		policy          Policy
+		secondaryFails  bool
+		expectedErr     bool
+		expectedPending int
+	}{
+		{title: "Success - both written", policy: PolicyLog},
+		{title: "Success - secondary failure logged", policy: PolicyLog, secondaryFails: true},
+		{title: "Success - secondary failure queued", policy: PolicyRetry, secondaryFails: true, expectedPending: 1},
+		{title: "Failure - secondary failure fails the write", policy: PolicyFail, secondaryFails: true, expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		s.Run(tc.title, func() {
+			primary := memory.New()
+			secondary := &failingStorage{Store: memory.New()}
+			secondary.fail.Store(tc.secondaryFails)
+			st, err := New(primary, secondary, tc.policy, nil)
+			s.NoError(err)
+
+			res, err := st.Put(context.TODO(), scan)
+			if tc.expectedErr {
+				s.Error(err)
+				s.Zero(res)
+			} else {
+				s.NoError(err)
+				s.Equal(database.Inserted, res.Outcome)
+			}
+			s.Equal(tc.expectedPending, st.Pending())
+			if tc.secondaryFails {
+				s.Equal(uint64(1), st.Failures())
+			}
+		})
+	}
+}
+
+func (s *DualWriteSuite) TestRetry() {
+	primary := memory.New()
+	secondary := &failingStorage{Store: memory.New()}
+	secondary.fail.Store(true)
+	st, err := New(primary, secondary, PolicyRetry, nil)
+	s.NoError(err)
+	st.retryInterval = time.Millisecond
+
+	_, err = st.Put(context.TODO(), scanData("1.1.1.1", 100, "hello").AsScan())
+	s.NoError(err)
+	s.Equal(1, st.Pending())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go st.Run(ctx)
+
+	// secondary is still down - the scan stays queued
+	time.Sleep(10 * time.Millisecond)
+	secondary.fail.Store(false)
+	s.Eventually(func() bool {
+		rows, _ := secondary.GetAll(context.TODO())
+		return len(rows) == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func (s *DualWriteSuite) TestRunReportsLostRetries() {
+	secondary := &failingStorage{Store: memory.New()}
+	secondary.fail.Store(true)
+	log := &logRecorder{}
+	st, err := New(memory.New(), secondary, PolicyRetry, log)
+	s.NoError(err)
+
+	_, err = st.Put(context.TODO(), scanData("1.1.1.1", 100, "hello").AsScan())
+	s.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	st.Run(ctx)
+	s.Equal(1, st.Pending())
+	s.Contains(log.errors[len(log.errors)-1], "1 secondary writes pending retry, they are lost")
+}
+
+// logRecorder - Logger which keeps the messages
+type logRecorder struct {
+	mtx    sync.Mutex
+	errors []string
+}
+
+func (l *logRecorder) Error(msg string, _ ...any) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.errors = append(l.errors, msg)
+}
+
+func (l *logRecorder) Info(string, ...any) {}
+
+func (s *DualWriteSuite) TestVerifyAndRepair() {
+	primary, secondary := memory.New(), memory.New()
+	put := func(st *memory.Store, row *database.ScanData) {
+		_, err := st.Put(context.TODO(), row.AsScan())
+		s.NoError(err)
+	}
+	put(primary, scanData("1.1.1.1", 100, "same"))
+	put(secondary, scanData("1.1.1.1", 100, "same"))
+	put(primary, scanData("1.1.1.2", 100, "only primary"))
+	put(secondary, scanData("1.1.1.3", 100, "only secondary"))
+	put(primary, scanData("1.1.1.4", 200, "primary newer"))
+	put(secondary, scanData("1.1.1.4", 100, "secondary older"))
+	put(primary, scanData("1.1.1.5", 100, "primary older"))
+	put(secondary, scanData("1.1.1.5", 200, "secondary newer"))
+	put(primary, scanData("1.1.1.6", 100, "one"))
+	put(secondary, scanData("1.1.1.6", 100, "another"))
+	enriched := scanData("1.1.1.7", 100, "same")
+	enriched.Fields = map[string]string{"geo.country": "NL"}
+	put(primary, enriched)
+	put(secondary, scanData("1.1.1.7", 100, "same"))
+
+	report, err := Verify(context.TODO(), primary, secondary)
+	s.NoError(err)
+	s.Equal(7, report.Checked)
+	s.False(report.Consistent())
+	kinds := map[DivergenceKind]int{}
+	for _, d := range report.Divergences {
+		kinds[d.Kind]++
+	}
+	s.Equal(map[DivergenceKind]int{
+		MissingInSecondary: 1,
+		MissingInPrimary:   1,
+		PrimaryNewer:       1,
+		SecondaryNewer:     1,
+		DataMismatch:       1,
+		PayloadMismatch:    1,
+	}, kinds)
+
+	n, err := Repair(context.TODO(), report, primary, secondary)
+	s.NoError(err)
+	s.Equal(5, n)
+	// repaired records are copied as they are, not observed once more
+	rows, err := secondary.GetAll(context.TODO())
+	s.NoError(err)
+	for _, row := range rows {
+		s.EqualValues(1, row.Observations)
+	}
+	changes, err := primary.Changes(context.TODO(), database.ChangeFilter{IP: "1.1.1.3"})
+	s.NoError(err)
+	s.Empty(changes)
+
+	report, err = Verify(context.TODO(), primary, secondary)
+	s.NoError(err)
+	s.Len(report.Divergences, 1)
+	s.Equal(DataMismatch, report.Divergences[0].Kind)
+}
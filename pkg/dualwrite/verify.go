@@ -0,0 +1,142 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"sort"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// Lister - storage which is able to return all of its records
+type Lister interface {
+	GetAll(ctx context.Context) (map[uint64]*database.ScanData, error)
+}
+
+// DivergenceKind - the way two storages disagree about a record
+type DivergenceKind uint8
+
+const (
+	// MissingInSecondary - the record exists only in the primary storage
+	MissingInSecondary DivergenceKind = iota
+	// MissingInPrimary - the record exists only in the secondary storage
+	MissingInPrimary
+	// PrimaryNewer - both storages have the record, the primary one has a fresher scan
+	PrimaryNewer
+	// SecondaryNewer - both storages have the record, the secondary one has a fresher scan
+	SecondaryNewer
+	// DataMismatch - both storages have the record with the same timestamp but different data
+	DataMismatch
+	// PayloadMismatch - both storages have the record with the same timestamp and data,
+	// but different charset, fields or details derived from it
+	PayloadMismatch
+)
+
+// String - human-readable divergence kind
+func (k DivergenceKind) String() string {
+	switch k {
+	case MissingInSecondary:
+		return "missing in secondary"
+	case MissingInPrimary:
+		return "missing in primary"
+	case PrimaryNewer:
+		return "primary is newer"
+	case SecondaryNewer:
+		return "secondary is newer"
+	case DataMismatch:
+		return "data mismatch"
+	case PayloadMismatch:
+		return "payload mismatch"
+	default:
+		return "unknown"
+	}
+}
+
+// Divergence - a single record two storages disagree about
+type Divergence struct {
+	Hash      uint64
+	Kind      DivergenceKind
+	Primary   *database.ScanData
+	Secondary *database.ScanData
+}
+
+// Report - result of the storages comparison
+type Report struct {
+	Checked     int
+	Divergences []Divergence
+}
+
+// Consistent - true if no divergence was found
+func (r *Report) Consistent() bool {
+	return len(r.Divergences) == 0
+}
+
+// Verify - compares both storages key by key, the whole stored payload but observations, which every storage counts on its own
+func Verify(ctx context.Context, primary, secondary Lister) (*Report, error) {
+	primaryRows, err := primary.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read primary storage: %w", err)
+	}
+	secondaryRows, err := secondary.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read secondary storage: %w", err)
+	}
+
+	report := &Report{}
+	for hash, p := range primaryRows {
+		report.Checked++
+		s, ok := secondaryRows[hash]
+		switch {
+		case !ok:
+			report.Divergences = append(report.Divergences, Divergence{Hash: hash, Kind: MissingInSecondary, Primary: p})
+		case p.Timestamp > s.Timestamp:
+			report.Divergences = append(report.Divergences, Divergence{Hash: hash, Kind: PrimaryNewer, Primary: p, Secondary: s})
+		case p.Timestamp < s.Timestamp:
+			report.Divergences = append(report.Divergences, Divergence{Hash: hash, Kind: SecondaryNewer, Primary: p, Secondary: s})
+		case p.Data != s.Data:
+			report.Divergences = append(report.Divergences, Divergence{Hash: hash, Kind: DataMismatch, Primary: p, Secondary: s})
+		case p.Charset != s.Charset || !maps.Equal(p.Fields, s.Fields) || !reflect.DeepEqual(p.Details, s.Details):
+			report.Divergences = append(report.Divergences, Divergence{Hash: hash, Kind: PayloadMismatch, Primary: p, Secondary: s})
+		}
+	}
+	for hash, s := range secondaryRows {
+		if _, ok := primaryRows[hash]; ok {
+			continue
+		}
+		report.Checked++
+		report.Divergences = append(report.Divergences, Divergence{Hash: hash, Kind: MissingInPrimary, Secondary: s})
+	}
+	// maps have no order - keep reports stable
+	sort.Slice(report.Divergences, func(i, j int) bool {
+		return report.Divergences[i].Hash < report.Divergences[j].Hash
+	})
+	return report, nil
+}
+
+// Repair - copies the freshest version of every diverged record into the storage which lags behind as it is
+// (see database.Loader), payload mismatches are resolved in favour of the primary storage, which derived them
+// from the same response, returns the number of repaired records, data mismatches with equal timestamps
+// are left for manual inspection
+func Repair(ctx context.Context, report *Report, primary, secondary database.Loader) (int, error) {
+	repaired := 0
+	for _, d := range report.Divergences {
+		var err error
+		switch d.Kind {
+		case MissingInSecondary, PrimaryNewer:
+			_, err = secondary.Load(ctx, d.Primary, false)
+		case MissingInPrimary, SecondaryNewer:
+			_, err = primary.Load(ctx, d.Secondary, false)
+		case PayloadMismatch:
+			_, err = secondary.Load(ctx, d.Primary, true)
+		default:
+			continue
+		}
+		if err != nil {
+			return repaired, fmt.Errorf("cannot repair record %d (%s): %w", d.Hash, d.Kind, err)
+		}
+		repaired++
+	}
+	return repaired, nil
+}
@@ -0,0 +1,174 @@
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/processing"
+)
+
+// ErrInjected - error returned by injected failures
+var ErrInjected = errors.New("injected storage fault")
+
+// Kind - injected fault kind
+type Kind uint8
+
+const (
+	// None - the call is passed through untouched
+	None Kind = iota
+	// Latency - the call is delayed before being passed through
+	Latency
+	// Error - the call fails without reaching the underlying storage
+	Error
+	// Timeout - the call hangs until the context is done and fails without reaching the underlying storage
+	Timeout
+	// CommittedError - the call reaches the underlying storage, but the error is returned anyway,
+	// just like a lost COMMIT acknowledgement
+	CommittedError
+)
+
+// String - human-readable fault kind
+func (k Kind) String() string {
+	switch k {
+	case None:
+		return "none"
+	case Latency:
+		return "latency"
+	case Error:
+		return "error"
+	case Timeout:
+		return "timeout"
+	case CommittedError:
+		return "committed error"
+	default:
+		return "unknown"
+	}
+}
+
+// Config - probabilistic faults configuration, probabilities are checked in the order
+// Error, Timeout, CommittedError, Latency and must not exceed 1 in total
+type Config struct {
+	ErrorProbability          float64
+	TimeoutProbability        float64
+	CommittedErrorProbability float64
+	LatencyProbability        float64
+	// Latency - the delay injected by Latency faults
+	Latency time.Duration
+	// Seed - random source seed, makes failure sequences reproducible
+	Seed int64
+}
+
+// Storage - processing.Storage decorator which injects failures into Put calls,
+// scripted faults (see Script) take precedence over the probabilistic ones
+type Storage struct {
+	next     processing.Storage
+	cfg      Config
+	mtx      sync.Mutex
+	rnd      *rand.Rand
+	script   []Kind
+	injected map[Kind]int
+}
+
+// New - Storage constructor
+func New(next processing.Storage, cfg Config) (*Storage, error) {
+	if next == nil {
+		return nil, fmt.Errorf("cannot instantiate fault-injection Storage, no storage provided")
+	}
+	total := 0.0
+	for _, p := range []float64{cfg.ErrorProbability, cfg.TimeoutProbability, cfg.CommittedErrorProbability, cfg.LatencyProbability} {
+		if p < 0 {
+			return nil, fmt.Errorf("cannot instantiate fault-injection Storage, negative probability %f", p)
+		}
+		total += p
+	}
+	if total > 1 {
+		return nil, fmt.Errorf("cannot instantiate fault-injection Storage, probabilities sum up to %f", total)
+	}
+	return &Storage{
+		next:     next,
+		cfg:      cfg,
+		rnd:      rand.New(rand.NewSource(cfg.Seed)),
+		injected: map[Kind]int{},
+	}, nil
+}
+
+// Script - queues faults which are injected into the next Put calls one by one
+func (s *Storage) Script(kinds ...Kind) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.script = append(s.script, kinds...)
+}
+
+// Injected - number of injected faults by kind
+func (s *Storage) Injected() map[Kind]int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	res := make(map[Kind]int, len(s.injected))
+	for k, n := range s.injected {
+		res[k] = n
+	}
+	return res
+}
+
+// Put - Put of the underlying storage with a fault injected
+func (s *Storage) Put(ctx context.Context, scan database.Scan) (database.Result, error) {
+	switch s.nextFault() {
+	case Latency:
+		select {
+		case <-ctx.Done():
+			return database.Result{}, ctx.Err()
+		case <-time.After(s.cfg.Latency):
+		}
+		return s.next.Put(ctx, scan)
+	case Error:
+		return database.Result{}, ErrInjected
+	case Timeout:
+		if _, ok := ctx.Deadline(); !ok {
+			return database.Result{}, fmt.Errorf("%w: %w", ErrInjected, context.DeadlineExceeded)
+		}
+		<-ctx.Done()
+		return database.Result{}, fmt.Errorf("%w: %w", ErrInjected, ctx.Err())
+	case CommittedError:
+		if _, err := s.next.Put(ctx, scan); err != nil {
+			return database.Result{}, err
+		}
+		return database.Result{}, ErrInjected
+	default:
+		return s.next.Put(ctx, scan)
+	}
+}
+
+func (s *Storage) nextFault() Kind {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	kind := None
+	if len(s.script) > 0 {
+		kind, s.script = s.script[0], s.script[1:]
+	} else {
+		p := s.rnd.Float64()
+		for _, candidate := range []struct {
+			kind        Kind
+			probability float64
+		}{
+			{Error, s.cfg.ErrorProbability},
+			{Timeout, s.cfg.TimeoutProbability},
+			{CommittedError, s.cfg.CommittedErrorProbability},
+			{Latency, s.cfg.LatencyProbability},
+		} {
+			if p < candidate.probability {
+				kind = candidate.kind
+				break
+			}
+			p -= candidate.probability
+		}
+	}
+	if kind != None {
+		s.injected[kind]++
+	}
+	return kind
+}
@@ -0,0 +1,218 @@
+package faults
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/memory"
+	"github.com/igorvan/scan-takehome/pkg/processing"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
+type FaultsSuite struct {
+	suite.Suite
+}
+
+func TestFaultsSuite(t *testing.T) {
+	suite.Run(t, &FaultsSuite{})
+}
+
+func newScan(ip string, ts int64) *processing.ScanResult {
+	data, _ := json.Marshal(scanning.V2Data{ResponseStr: fmt.Sprintf("response at %d", ts)})
+	res, err := processing.NewScanResult(ip, 443, "HTTP", ts, data, scanning.V2)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+func (s *FaultsSuite) TestNew() {
+	_, err := New(nil, Config{})
+	s.Error(err)
+	_, err = New(memory.New(), Config{ErrorProbability: 0.7, TimeoutProbability: 0.7})
+	s.Error(err)
+	_, err = New(memory.New(), Config{ErrorProbability: -1})
+	s.Error(err)
+}
+
+func (s *FaultsSuite) TestScript() {
+	store := memory.New()
+	st, err := New(store, Config{Latency: time.Millisecond})
+	s.NoError(err)
+	st.Script(Error, CommittedError, Latency, Timeout)
+
+	ctx := context.TODO()
+	_, err = st.Put(ctx, newScan("1.1.1.1", 100))
+	s.ErrorIs(err, ErrInjected)
+	rows, _ := store.GetAll(ctx)
+	s.Empty(rows)
+
+	// committed, but reported as failed
+	_, err = st.Put(ctx, newScan("1.1.1.1", 100))
+	s.ErrorIs(err, ErrInjected)
+	rows, _ = store.GetAll(ctx)
+	s.Len(rows, 1)
+
+	res, err := st.Put(ctx, newScan("1.1.1.1", 200))
+	s.NoError(err)
+	s.Equal(database.Updated, res.Outcome)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	_, err = st.Put(timeoutCtx, newScan("1.1.1.1", 300))
+	s.ErrorIs(err, context.DeadlineExceeded)
+
+	// the script is exhausted - pass through
+	res, err = st.Put(ctx, newScan("1.1.1.1", 300))
+	s.NoError(err)
+	s.Equal(database.Updated, res.Outcome)
+
+	s.Equal(map[Kind]int{Error: 1, CommittedError: 1, Latency: 1, Timeout: 1}, st.Injected())
+}
+
+// TestAtLeastOnce - feeds shuffled and duplicated scans through a Receiver backed by a faulty storage,
+// redelivering every failed message just like Pub/Sub does for nacked ones,
+// and checks that no scan is lost and no record ever goes back in time
+func (s *FaultsSuite) TestAtLeastOnce() {
+	const (
+		hosts        = 20
+		scansPerHost = 30
+		workers      = 8
+	)
+	testCases := []struct {
+		title string
+		cfg   Config
+	}{
+		{
+			title: "Errors",
+			cfg:   Config{ErrorProbability: 0.3, Seed: 1},
+		},
+		{
+			title: "Timeouts",
+			cfg:   Config{TimeoutProbability: 0.2, Seed: 2},
+		},
+		{
+			title: "Committed but returned error",
+			cfg:   Config{CommittedErrorProbability: 0.4, Seed: 3},
+		},
+		{
+			title: "Everything at once",
+			cfg: Config{
+				ErrorProbability:          0.15,
+				TimeoutProbability:        0.1,
+				CommittedErrorProbability: 0.15,
+				LatencyProbability:        0.2,
+				Latency:                   time.Millisecond,
+				Seed:                      4,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		s.Run(tc.title, func() {
+			store := memory.New()
+			faulty, err := New(store, tc.cfg)
+			s.NoError(err)
+			receiver, err := processing.New(faulty)
+			s.NoError(err)
+
+			rnd := rand.New(rand.NewSource(tc.cfg.Seed))
+			expected := map[uint64]int64{}
+			var messages []*processing.ScanResult
+			for h := 0; h < hosts; h++ {
+				for i := 0; i < scansPerHost; i++ {
+					ip, ts := fmt.Sprintf("10.0.0.%d", h), int64(1000+rnd.Intn(10000))
+					scan := newScan(ip, ts)
+					messages = append(messages, scan)
+					if rnd.Intn(5) == 0 {
+						// at-least-once delivery - some messages come twice
+						messages = append(messages, newScan(ip, ts))
+					}
+					if hash := database.Hash(scan); scan.Timestamp() > expected[hash] {
+						expected[hash] = scan.Timestamp()
+					}
+				}
+			}
+			rnd.Shuffle(len(messages), func(i, j int) { messages[i], messages[j] = messages[j], messages[i] })
+
+			queue := make(chan *processing.ScanResult, len(messages))
+			for _, m := range messages {
+				queue <- m
+			}
+			var pending sync.WaitGroup
+			pending.Add(len(messages))
+
+			stop := make(chan struct{})
+			regressions := s.observe(store, stop)
+
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for m := range queue {
+						ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+						_, err := receiver.Process(ctx, m)
+						cancel()
+						if err != nil {
+							// nack - redeliver
+							queue <- m
+							continue
+						}
+						pending.Done()
+					}
+				}()
+			}
+			pending.Wait()
+			close(queue)
+			wg.Wait()
+			close(stop)
+
+			s.Zero(<-regressions)
+			rows, err := store.GetAll(context.TODO())
+			s.NoError(err)
+			s.Len(rows, len(expected))
+			for hash, ts := range expected {
+				s.Equal(ts, rows[hash].Timestamp)
+				s.Equal(fmt.Sprintf("response at %d", ts), rows[hash].Data)
+			}
+			s.NotEmpty(faulty.Injected())
+		})
+	}
+}
+
+// observe - periodically snapshots the storage and counts records whose timestamp went backwards
+func (s *FaultsSuite) observe(store *memory.Store, stop <-chan struct{}) <-chan int {
+	res := make(chan int, 1)
+	go func() {
+		regressions := 0
+		previous := map[uint64]*database.ScanData{}
+		for {
+			select {
+			case <-stop:
+				res <- regressions
+				return
+			case <-time.After(time.Millisecond):
+			}
+			rows, err := store.GetAll(context.TODO())
+			if err != nil {
+				continue
+			}
+			for hash, row := range previous {
+				if rows[hash] == nil || rows[hash].Timestamp < row.Timestamp {
+					regressions++
+				}
+			}
+			previous = rows
+		}
+	}()
+	return res
+}
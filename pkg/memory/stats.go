@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+var _ database.Aggregator = (*Store)(nil)
+
+// CountByService - number of records per service, the most popular services first
+func (s *Store) CountByService(ctx context.Context) ([]database.ServiceCount, error) {
+	counts, err := countBy(ctx, s, func(row *database.ScanData) string { return row.Service })
+	if err != nil {
+		return nil, err
+	}
+	res := make([]database.ServiceCount, 0, len(counts))
+	for service, n := range counts {
+		res = append(res, database.ServiceCount{Service: service, Count: n})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Service < res[j].Service
+	})
+	return res, nil
+}
+
+// TopPorts - the limit ports with the most records, limit must be positive
+func (s *Store) TopPorts(ctx context.Context, limit int) ([]database.PortCount, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid top ports limit %d", limit)
+	}
+	counts, err := countBy(ctx, s, func(row *database.ScanData) uint32 { return row.Port })
+	if err != nil {
+		return nil, err
+	}
+	res := make([]database.PortCount, 0, len(counts))
+	for port, n := range counts {
+		res = append(res, database.PortCount{Port: port, Count: n})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Port < res[j].Port
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// CountHosts - number of distinct IP addresses
+func (s *Store) CountHosts(ctx context.Context) (int64, error) {
+	counts, err := countBy(ctx, s, func(row *database.ScanData) string { return row.IP })
+	return int64(len(counts)), err
+}
+
+// CountByDay - number of records per last scanned day, in chronological order
+func (s *Store) CountByDay(ctx context.Context) ([]database.DayCount, error) {
+	counts, err := countBy(ctx, s, func(row *database.ScanData) string { return database.DayOf(row.Timestamp) })
+	if err != nil {
+		return nil, err
+	}
+	res := make([]database.DayCount, 0, len(counts))
+	for day, n := range counts {
+		res = append(res, database.DayCount{Day: day, Count: n})
+	}
+	// YYYY-MM-DD sorts chronologically
+	sort.Slice(res, func(i, j int) bool { return res[i].Day < res[j].Day })
+	return res, nil
+}
+
+// countBy - single pass over the stored records counting them by key
+func countBy[K comparable](ctx context.Context, s *Store, key func(row *database.ScanData) K) (map[K]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	res := map[K]int64{}
+	for _, row := range s.data {
+		res[key(row)]++
+	}
+	return res, nil
+}
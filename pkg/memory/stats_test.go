@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+type StatsSuite struct {
+	suite.Suite
+}
+
+func TestStatsSuite(t *testing.T) {
+	suite.Run(t, &StatsSuite{})
+}
+
+func (s *StatsSuite) TestAggregates() {
+	store := New()
+	for _, row := range []*database.ScanData{
+		{IP: "1.1.1.1", Port: 80, Service: "HTTP", Timestamp: 10},
+		{IP: "1.1.1.1", Port: 22, Service: "SSH", Timestamp: 86400},
+		{IP: "1.1.1.2", Port: 80, Service: "HTTP", Timestamp: 86401},
+		{IP: "1.1.1.3", Port: 8080, Service: "HTTP", Timestamp: 86402},
+		{IP: "1.1.1.3", Port: 53, Service: "DNS", Timestamp: 5},
+	} {
+		_, err := store.Put(context.TODO(), row.AsScan())
+		s.NoError(err)
+	}
+
+	services, err := store.CountByService(context.TODO())
+	s.NoError(err)
+	s.Equal([]database.ServiceCount{{Service: "HTTP", Count: 3}, {Service: "DNS", Count: 1}, {Service: "SSH", Count: 1}}, services)
+
+	ports, err := store.TopPorts(context.TODO(), 2)
+	s.NoError(err)
+	s.Equal([]database.PortCount{{Port: 80, Count: 2}, {Port: 22, Count: 1}}, ports)
+	for _, limit := range []int{0, -1} {
+		_, err = store.TopPorts(context.TODO(), limit)
+		s.Error(err)
+	}
+
+	hosts, err := store.CountHosts(context.TODO())
+	s.NoError(err)
+	s.Equal(int64(3), hosts)
+
+	days, err := store.CountByDay(context.TODO())
+	s.NoError(err)
+	s.Equal([]database.DayCount{{Day: "1970-01-01", Count: 2}, {Day: "1970-01-02", Count: 3}}, days)
+}
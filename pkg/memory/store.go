@@ -0,0 +1,272 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// Store - in-memory scan results storage with the same newest-wins semantics as the MySQL client,
+// handy for tests and for rehearsing storage migrations
+type Store struct {
+	mtx     sync.RWMutex
+	data    map[uint64]*database.ScanData
+	changes []*database.ChangeRecord
+	expiry  time.Duration
+}
+
+// Option - Store configuration option
+type Option func(s *Store)
+
+// WithExpiry - records not seen for longer than expiry are considered expired,
+// database.DefaultExpiry by default, 0 disables expiry
+func WithExpiry(expiry time.Duration) Option {
+	return func(s *Store) {
+		s.expiry = expiry
+	}
+}
+
+// New - Store constructor
+func New(opts ...Option) *Store {
+	s := &Store{data: map[uint64]*database.ScanData{}, expiry: database.DefaultExpiry}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Put - insert or update scan results, older scans are ignored
+// new, changed and reappeared records are written into the change log (see Changes)
+// returns one of database.Stale, database.Inserted, database.Updated, database.Unchanged or database.Reappeared outcomes
+func (s *Store) Put(ctx context.Context, scan database.Scan) (database.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return database.Result{}, err
+	}
+	hash := database.Hash(scan)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	existing, ok := s.data[hash]
+	if ok && existing.Timestamp >= scan.Timestamp() {
+		return database.Result{Outcome: database.Stale}, nil
+	}
+	var previous int64
+	if ok {
+		previous = existing.Timestamp
+	}
+	if ok && existing.Data == scan.Data() {
+		existing.Timestamp = scan.Timestamp()
+		existing.Fields = maps.Clone(database.FieldsOf(scan))
+		existing.Details = database.DetailsOf(scan).Clone()
+		existing.Observations++
+		return s.logChange(scan, database.Unchanged, previous), nil
+	}
+	row := &database.ScanData{
+		IP:           scan.IP(),
+		Port:         scan.Port(),
+		Service:      scan.Service(),
+		Timestamp:    scan.Timestamp(),
+		Data:         scan.Data(),
+		Charset:      database.CharsetOf(scan),
+		Fields:       maps.Clone(database.FieldsOf(scan)),
+		Details:      database.DetailsOf(scan).Clone(),
+		Observations: 1,
+		Hash:         hash,
+	}
+	s.data[hash] = row
+	if ok {
+		row.Observations = existing.Observations + 1
+		return s.logChange(scan, database.Updated, previous), nil
+	}
+	return s.logChange(scan, database.Inserted, 0), nil
+}
+
+// logChange - classifies the written scan and logs the change if it's worth logging, returns the final result
+func (s *Store) logChange(scan database.Scan, outcome database.Outcome, previous int64) database.Result {
+	if previous != 0 && database.Expired(previous, scan.Timestamp(), s.expiry) {
+		outcome = database.Reappeared
+	}
+	if change := database.ChangeOf(outcome); change.Logged() {
+		s.changes = append(s.changes, &database.ChangeRecord{
+			ID:          int64(len(s.changes) + 1),
+			Hash:        database.Hash(scan),
+			Service:     scan.Service(),
+			IP:          scan.IP(),
+			Port:        scan.Port(),
+			Timestamp:   scan.Timestamp(),
+			Previous:    previous,
+			Change:      change,
+			ContentHash: database.ContentHash(scan.Data()),
+		})
+	}
+	return database.Result{Outcome: outcome}
+}
+
+// PutBatch - Put of every scan in order, the store never fails halfway
+func (s *Store) PutBatch(ctx context.Context, scans []database.Scan) ([]database.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	results := make([]database.Result, len(scans))
+	for i, scan := range scans {
+		res, err := s.Put(ctx, scan)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = res
+	}
+	return results, nil
+}
+
+// Load - writes a copy of the record as it is: unlike Put, its observations are kept and nothing is written
+// into the change log, the stored record is only replaced by a fresher one, or by one as fresh as itself
+// if overwrite is set, returns one of database.Stale, database.Inserted or database.Updated outcomes
+func (s *Store) Load(ctx context.Context, row *database.ScanData, overwrite bool) (database.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return database.Result{}, err
+	}
+	cp := clone(row)
+	cp.Hash = database.Hash(row.AsScan())
+	cp.Charset = database.CharsetOf(row.AsScan())
+	cp.Observations = max(row.Observations, 1)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	existing, ok := s.data[cp.Hash]
+	switch {
+	case !ok:
+		s.data[cp.Hash] = cp
+		return database.Result{Outcome: database.Inserted}, nil
+	case existing.Timestamp < cp.Timestamp || (overwrite && existing.Timestamp == cp.Timestamp):
+		s.data[cp.Hash] = cp
+		return database.Result{Outcome: database.Updated}, nil
+	default:
+		return database.Result{Outcome: database.Stale}, nil
+	}
+}
+
+// GetAll - get a copy of all stored data
+func (s *Store) GetAll(ctx context.Context) (map[uint64]*database.ScanData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	res := make(map[uint64]*database.ScanData, len(s.data))
+	for hash, row := range s.data {
+		res[hash] = clone(row)
+	}
+	return res, nil
+}
+
+// FindByField - records of the service whose parsed field has the value, the most recent first
+func (s *Store) FindByField(ctx context.Context, service, field, value string) ([]*database.ScanData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var res []*database.ScanData
+	for _, row := range s.data {
+		if v, ok := row.Fields[field]; ok && v == value && row.Service == service {
+			res = append(res, clone(row))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Timestamp > res[j].Timestamp })
+	return res, nil
+}
+
+// ListRecords - at most limit records of the service (of every service if empty) with hashes greater than after, in hash order
+func (s *Store) ListRecords(ctx context.Context, service string, after uint64, limit int) ([]*database.ScanData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var res []*database.ScanData
+	for hash, row := range s.data {
+		if hash > after && (service == "" || row.Service == service) {
+			res = append(res, clone(row))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Hash < res[j].Hash })
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// SetFields - replaces the fields of the record, unless a fresher scan has been written into it since it was read,
+// returns true if the record was changed
+func (s *Store) SetFields(ctx context.Context, row *database.ScanData, fields map[string]string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	existing, ok := s.data[row.Hash]
+	if !ok || existing.Timestamp != row.Timestamp || maps.Equal(existing.Fields, fields) {
+		return false, nil
+	}
+	existing.Fields = maps.Clone(fields)
+	return true, nil
+}
+
+// Changes - change log entries matching the filter, the most recent first
+func (s *Store) Changes(ctx context.Context, f database.ChangeFilter) ([]*database.ChangeRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = database.DefaultChangesLimit
+	}
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var res []*database.ChangeRecord
+	for _, rec := range s.changes {
+		if f.Match(rec) {
+			cp := *rec
+			res = append(res, &cp)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Timestamp != res[j].Timestamp {
+			return res[i].Timestamp > res[j].Timestamp
+		}
+		return res[i].ID > res[j].ID
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// clone - deep copy of the stored record
+func clone(row *database.ScanData) *database.ScanData {
+	cp := *row
+	cp.Fields = maps.Clone(row.Fields)
+	cp.Details = row.Details.Clone()
+	return &cp
+}
+
+// Snapshot - streams a point-in-time copy of every stored record into fn
+func (s *Store) Snapshot(ctx context.Context, fn func(row *database.ScanData) error) error {
+	rows, err := s.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
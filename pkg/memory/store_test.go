@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+type StoreSuite struct {
+	suite.Suite
+}
+
+func TestStoreSuite(t *testing.T) {
+	suite.Run(t, &StoreSuite{})
+}
+
+func (s *StoreSuite) TestPut() {
+	store := New()
+	testCases := []struct {
+		title     string
+		timestamp int64
+		data      string
+		fields    map[string]string
+		expected  database.Outcome
+	}{
+		{title: "first scan", timestamp: 100, data: "banner", expected: database.Inserted},
+		{title: "same banner", timestamp: 200, data: "banner", fields: map[string]string{"geo.country": "NL"}, expected: database.Unchanged},
+		{title: "new banner", timestamp: 300, data: "new banner", expected: database.Updated},
+		{title: "older scan", timestamp: 250, data: "new banner", expected: database.Stale},
+	}
+	for _, tc := range testCases {
+		s.Run(tc.title, func() {
+			res, err := store.Put(context.TODO(), (&database.ScanData{
+				IP: "1.1.1.1", Port: 80, Service: "HTTP", Timestamp: tc.timestamp, Data: tc.data, Fields: tc.fields,
+			}).AsScan())
+			s.NoError(err)
+			s.Equal(tc.expected, res.Outcome)
+		})
+	}
+
+	rows, err := store.GetAll(context.TODO())
+	s.NoError(err)
+	s.Len(rows, 1)
+	for _, row := range rows {
+		s.Equal("new banner", row.Data)
+		s.EqualValues(300, row.Timestamp)
+		s.EqualValues(3, row.Observations)
+		s.Nil(row.Fields)
+	}
+}
+
+func (s *StoreSuite) TestChanges() {
+	store := New(WithExpiry(time.Hour))
+	put := func(timestamp int64, data string) database.Outcome {
+		res, err := store.Put(context.TODO(), (&database.ScanData{
+			IP: "1.1.1.1", Port: 80, Service: "HTTP", Timestamp: timestamp, Data: data,
+		}).AsScan())
+		s.Require().NoError(err)
+		return res.Outcome
+	}
+	s.Equal(database.Inserted, put(100, "banner"))
+	s.Equal(database.Unchanged, put(200, "banner"))
+	s.Equal(database.Updated, put(300, "new banner"))
+	s.Equal(database.Stale, put(250, "banner"))
+	// gone for more than an hour, whether the banner changed or not
+	s.Equal(database.Reappeared, put(5000, "new banner"))
+	s.Equal(database.Reappeared, put(9000, "banner"))
+
+	changes, err := store.Changes(context.TODO(), database.ChangeFilter{})
+	s.NoError(err)
+	s.Require().Len(changes, 4)
+	for i, expected := range []struct {
+		change    database.Change
+		timestamp int64
+		previous  int64
+	}{
+		{database.ChangeReappeared, 9000, 5000},
+		{database.ChangeReappeared, 5000, 300},
+		{database.ChangeChanged, 300, 200},
+		{database.ChangeNew, 100, 0},
+	} {
+		s.Equal(expected.change, changes[i].Change)
+		s.Equal(expected.timestamp, changes[i].Timestamp)
+		s.Equal(expected.previous, changes[i].Previous)
+	}
+	s.Equal(database.ContentHash("banner"), changes[0].ContentHash)
+
+	changes, err = store.Changes(context.TODO(), database.ChangeFilter{
+		Changes: []database.Change{database.ChangeReappeared}, Since: 6000,
+	})
+	s.NoError(err)
+	s.Len(changes, 1)
+	changes, err = store.Changes(context.TODO(), database.ChangeFilter{Limit: 2})
+	s.NoError(err)
+	s.Len(changes, 2)
+	changes, err = store.Changes(context.TODO(), database.ChangeFilter{IP: "2.2.2.2"})
+	s.NoError(err)
+	s.Empty(changes)
+}
+
+func (s *StoreSuite) TestLoad() {
+	store := New()
+	load := func(timestamp int64, fields map[string]string, overwrite bool) database.Outcome {
+		res, err := store.Load(context.TODO(), &database.ScanData{
+			IP: "1.1.1.1", Port: 80, Service: "HTTP", Timestamp: timestamp, Data: "banner", Fields: fields, Observations: 5,
+		}, overwrite)
+		s.Require().NoError(err)
+		return res.Outcome
+	}
+	s.Equal(database.Inserted, load(100, nil, false))
+	s.Equal(database.Stale, load(100, map[string]string{"geo.country": "NL"}, false))
+	s.Equal(database.Updated, load(100, map[string]string{"geo.country": "NL"}, true))
+	s.Equal(database.Stale, load(50, nil, true))
+
+	rows, err := store.GetAll(context.TODO())
+	s.NoError(err)
+	s.Require().Len(rows, 1)
+	for _, row := range rows {
+		s.Equal(map[string]string{"geo.country": "NL"}, row.Fields)
+		s.EqualValues(5, row.Observations)
+	}
+	changes, err := store.Changes(context.TODO(), database.ChangeFilter{})
+	s.NoError(err)
+	s.Empty(changes)
+}
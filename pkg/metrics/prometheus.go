@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// Prometheus - Recorder backed by Prometheus collectors
+type Prometheus struct {
+	latency *prometheus.HistogramVec
+	errors  *prometheus.CounterVec
+	// outcomes - storage operations which succeeded by outcome, an operation is counted even if the processor
+	// has given up waiting for it (then the scan is redelivered and counted again)
+	outcomes *prometheus.CounterVec
+	rejected *prometheus.CounterVec
+	// processed - scans whose result the processor got by outcome, one per acked scan,
+	// it counts the same writes as outcomes from the point of view of the scans rather than of the storage
+	processed *prometheus.CounterVec
+}
+
+// NewPrometheus - Prometheus constructor, registers the collectors in the provided registerer
+func NewPrometheus(reg prometheus.Registerer, namespace string) (*Prometheus, error) {
+	p := &Prometheus{
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "operation_duration_seconds",
+			Help:      "Storage operations latency.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"op"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "errors_total",
+			Help:      "Failed storage operations by error class.",
+		}, []string{"op", "class"}),
+		outcomes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "outcomes_total",
+			Help:      "Successful storage operations by outcome.",
+		}, []string{"op", "outcome"}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "scans",
+			Name:      "rejected_total",
+			Help:      "Scans rejected before reaching the storage by reason.",
+		}, []string{"reason"}),
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "scans",
+			Name:      "processed_total",
+			Help:      "Scans which reached the storage by outcome, one per acked scan unlike storage_outcomes_total.",
+		}, []string{"outcome"}),
+	}
+	for _, c := range []prometheus.Collector{p.latency, p.errors, p.outcomes, p.rejected, p.processed} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// ObserveLatency - records a single storage operation duration
+func (p *Prometheus) ObserveLatency(op string, d time.Duration) {
+	p.latency.WithLabelValues(op).Observe(d.Seconds())
+}
+
+// IncError - counts a failed storage operation
+func (p *Prometheus) IncError(op, class string) {
+	p.errors.WithLabelValues(op, class).Inc()
+}
+
+// IncOutcome - counts a successful storage operation by its outcome
+func (p *Prometheus) IncOutcome(op, outcome string) {
+	p.outcomes.WithLabelValues(op, outcome).Inc()
+}
+
+// IncRejected - counts a scan rejected before reaching the storage
+func (p *Prometheus) IncRejected(reason string) {
+	p.rejected.WithLabelValues(reason).Inc()
+}
+
+// IncResult - counts a processed scan by its outcome (see database.Outcome), rejected scans are counted by reason (see IncRejected)
+func (p *Prometheus) IncResult(res database.Result) {
+	if res.Outcome == database.Rejected {
+		p.IncRejected(res.Reason)
+		return
+	}
+	p.processed.WithLabelValues(res.Outcome.String()).Inc()
+}
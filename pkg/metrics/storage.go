@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/processing"
+)
+
+// Operation names
+const (
+	OpPut      = "put"
+	OpPutBatch = "put_batch"
+)
+
+// Error classes
+const (
+	ErrorTimeout    = "timeout"
+	ErrorCanceled   = "canceled"
+	ErrorConnection = "connection"
+	ErrorDatabase   = "database"
+	ErrorOther      = "other"
+)
+
+// Recorder - metrics sink, implementations must be safe for concurrent use
+type Recorder interface {
+	// ObserveLatency - records a single storage operation duration
+	ObserveLatency(op string, d time.Duration)
+	// IncError - counts a failed storage operation
+	IncError(op, class string)
+	// IncOutcome - counts a successful storage operation by its outcome (see database.Outcome)
+	IncOutcome(op, outcome string)
+}
+
+// Storage - processing.Storage decorator which reports every operation into a Recorder
+type Storage struct {
+	next     processing.Storage
+	recorder Recorder
+}
+
+// New - Storage constructor
+func New(next processing.Storage, recorder Recorder) (*Storage, error) {
+	if next == nil {
+		return nil, fmt.Errorf("cannot instantiate metrics Storage, no storage provided")
+	}
+	if recorder == nil {
+		return nil, fmt.Errorf("cannot instantiate metrics Storage, no recorder provided")
+	}
+	return &Storage{next: next, recorder: recorder}, nil
+}
+
+// Put - instrumented Put of the underlying storage
+func (s *Storage) Put(ctx context.Context, scan database.Scan) (database.Result, error) {
+	start := time.Now()
+	res, err := s.next.Put(ctx, scan)
+	s.recorder.ObserveLatency(OpPut, time.Since(start))
+	if err != nil {
+		s.recorder.IncError(OpPut, ClassifyError(err))
+		return res, err
+	}
+	s.recorder.IncOutcome(OpPut, res.Outcome.String())
+	return res, nil
+}
+
+// PutBatch - instrumented PutBatch of the underlying storage, falls back to instrumented Put of every scan
+// if the underlying storage cannot write batches (then a failed batch may be written partially)
+func (s *Storage) PutBatch(ctx context.Context, scans []database.Scan) ([]database.Result, error) {
+	batch, ok := s.next.(processing.BatchStorage)
+	if !ok {
+		results := make([]database.Result, len(scans))
+		for i, scan := range scans {
+			res, err := s.Put(ctx, scan)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = res
+		}
+		return results, nil
+	}
+
+	start := time.Now()
+	results, err := batch.PutBatch(ctx, scans)
+	s.recorder.ObserveLatency(OpPutBatch, time.Since(start))
+	if err != nil {
+		s.recorder.IncError(OpPutBatch, ClassifyError(err))
+		return nil, err
+	}
+	for _, res := range results {
+		s.recorder.IncOutcome(OpPutBatch, res.Outcome.String())
+	}
+	return results, nil
+}
+
+// ClassifyError - maps a storage error into a low-cardinality error class
+func ClassifyError(err error) string {
+	var (
+		netErr   net.Error
+		mysqlErr *mysql.MySQLError
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorCanceled
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), errors.Is(err, mysql.ErrInvalidConn):
+		return ErrorConnection
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ErrorTimeout
+		}
+		return ErrorConnection
+	case errors.As(err, &mysqlErr), errors.Is(err, sql.ErrTxDone):
+		return ErrorDatabase
+	default:
+		return ErrorOther
+	}
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/memory"
+)
+
+type recorderMock struct {
+	mtx       sync.Mutex
+	latencies int
+	errors    map[string]int
+	outcomes  map[string]int
+}
+
+func (r *recorderMock) ObserveLatency(string, time.Duration) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.latencies++
+}
+
+func (r *recorderMock) IncError(_, class string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.errors[class]++
+}
+
+func (r *recorderMock) IncOutcome(_, outcome string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.outcomes[outcome]++
+}
+
+type brokenStorage struct {
+	err error
+}
+
+func (b *brokenStorage) Put(context.Context, database.Scan) (database.Result, error) {
+	return database.Result{}, b.err
+}
+
+type MetricsSuite struct {
+	suite.Suite
+}
+
+func TestMetricsSuite(t *testing.T) {
+	suite.Run(t, &MetricsSuite{})
+}
+
+func (s *MetricsSuite) TestPut() {
+	rec := &recorderMock{errors: map[string]int{}, outcomes: map[string]int{}}
+	st, err := New(memory.New(), rec)
+	s.NoError(err)
+
+	put := func(ts int64, data string) {
+		_, err := st.Put(context.TODO(), (&database.ScanData{IP: "1.1.1.1", Port: 22, Service: "SSH", Timestamp: ts, Data: data}).AsScan())
+		s.NoError(err)
+	}
+	put(100, "x")
+	put(200, "y")
+	put(300, "y")
+	put(150, "z")
+	// seen again after the default expiry
+	put(300+int64(database.DefaultExpiry/time.Second)+1, "y")
+
+	broken, err := New(&brokenStorage{err: context.DeadlineExceeded}, rec)
+	s.NoError(err)
+	_, err = broken.Put(context.TODO(), (&database.ScanData{}).AsScan())
+	s.Error(err)
+
+	s.Equal(6, rec.latencies)
+	s.Equal(map[string]int{"inserted": 1, "updated": 1, "unchanged": 1, "stale": 1, "reappeared": 1}, rec.outcomes)
+	s.Equal(map[string]int{ErrorTimeout: 1}, rec.errors)
+}
+
+func (s *MetricsSuite) TestPutBatch() {
+	rec := &recorderMock{errors: map[string]int{}, outcomes: map[string]int{}}
+	st, err := New(memory.New(), rec)
+	s.NoError(err)
+
+	scans := []database.Scan{
+		(&database.ScanData{IP: "1.1.1.1", Port: 22, Service: "SSH", Timestamp: 100, Data: "x"}).AsScan(),
+		(&database.ScanData{IP: "1.1.1.2", Port: 22, Service: "SSH", Timestamp: 100, Data: "x"}).AsScan(),
+	}
+	results, err := st.PutBatch(context.TODO(), scans)
+	s.NoError(err)
+	s.Equal([]database.Result{{Outcome: database.Inserted}, {Outcome: database.Inserted}}, results)
+	s.Equal(1, rec.latencies)
+	s.Equal(map[string]int{"inserted": 2}, rec.outcomes)
+
+	// no batch support - every scan is instrumented on its own
+	broken, err := New(&brokenStorage{err: context.Canceled}, rec)
+	s.NoError(err)
+	_, err = broken.PutBatch(context.TODO(), scans)
+	s.ErrorIs(err, context.Canceled)
+	s.Equal(2, rec.latencies)
+	s.Equal(map[string]int{ErrorCanceled: 1}, rec.errors)
+}
+
+func (s *MetricsSuite) TestClassifyError() {
+	testCases := []struct {
+		err      error
+		expected string
+	}{
+		{err: fmt.Errorf("wrapped: %w", context.DeadlineExceeded), expected: ErrorTimeout},
+		{err: context.Canceled, expected: ErrorCanceled},
+		{err: driver.ErrBadConn, expected: ErrorConnection},
+		{err: &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, expected: ErrorDatabase},
+		{err: fmt.Errorf("something odd"), expected: ErrorOther},
+	}
+	for _, tc := range testCases {
+		s.Equal(tc.expected, ClassifyError(tc.err), tc.err.Error())
+	}
+}
+
+func (s *MetricsSuite) TestPrometheus() {
+	reg := prometheus.NewRegistry()
+	p, err := NewPrometheus(reg, "test")
+	s.NoError(err)
+
+	p.ObserveLatency(OpPut, time.Millisecond)
+	p.IncError(OpPut, ErrorTimeout)
+	p.IncOutcome(OpPut, "inserted")
+	p.IncOutcome(OpPut, "inserted")
+	p.IncRejected("invalid_ip")
+	p.IncResult(database.Result{Outcome: database.Unchanged})
+	p.IncResult(database.Rejection("invalid_ip"))
+
+	s.Equal(float64(2), testutil.ToFloat64(p.outcomes.WithLabelValues(OpPut, "inserted")))
+	s.Equal(float64(1), testutil.ToFloat64(p.errors.WithLabelValues(OpPut, ErrorTimeout)))
+	s.Equal(1, testutil.CollectAndCount(p.latency))
+	s.Equal(float64(2), testutil.ToFloat64(p.rejected.WithLabelValues("invalid_ip")))
+	s.Equal(float64(1), testutil.ToFloat64(p.processed.WithLabelValues("unchanged")))
+
+	// registering the same collectors twice must fail loudly
+	_, err = NewPrometheus(reg, "test")
+	s.Error(err)
+}
@@ -0,0 +1,173 @@
+package processing
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// BatchResult - result of a single ProcessBatch scan, the same Process would return for it
+type BatchResult struct {
+	// Result - database.Stale for scans superseded by a newer scan of the same record within the batch
+	Result database.Result
+	Err    error
+}
+
+// ProcessBatch - like Process for every scan, but the scans which make it through validation and interceptors
+// are written together: only the newest scan of every record is written (older ones are reported as database.Stale),
+// and BatchStorage writes them in a single operation
+// returns a result per scan in the order of scans, so every message can be acked or nacked on its own
+// interceptors run concurrently for the scans of a batch and must call next at most once, before they return
+func (r *Receiver) ProcessBatch(ctx context.Context, scans []*ScanResult) []BatchResult {
+	results := make([]BatchResult, len(scans))
+	b := &batch{ctx: ctx, storage: r.storage}
+	items := make([]*batchItem, len(scans))
+	for i, scn := range scans {
+		if err := checkDecoded(scn); err != nil {
+			res, err := resultOf(database.Result{}, err)
+			results[i] = BatchResult{Result: res, Err: err}
+			continue
+		}
+		items[i] = &batchItem{index: i}
+		b.pending++
+	}
+
+	handler := chain(r.chained, b.put)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		if item == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := resultOf(handler(context.WithValue(ctx, batchItemKey{}, item), scans[i]))
+			// the scan didn't make it to the storage - the rest of the batch shouldn't wait for it
+			b.leave(item)
+			results[i] = BatchResult{Result: res, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+type batchItemKey struct{}
+
+// batchItem - a scan of the batch on its way through the interceptors
+type batchItem struct {
+	index int
+	// done - the scan has either reached the storage or left the chain, guarded by batch.mtx
+	done bool
+}
+
+// arrival - a scan which has reached the storage, waiting for the batch to be written
+type arrival struct {
+	item *batchItem
+	scn  *ScanResult
+	res  chan putResult
+}
+
+// putResult - storage result of an arrival
+type putResult struct {
+	res database.Result
+	err error
+}
+
+// batch - collects the scans of a batch reaching the storage, writes them once all the scans are done with interceptors
+type batch struct {
+	ctx      context.Context
+	storage  Storage
+	mtx      sync.Mutex
+	pending  int
+	arrivals []*arrival
+}
+
+// put - the last handler of the batch chain
+func (b *batch) put(ctx context.Context, scn *ScanResult) (database.Result, error) {
+	item, _ := ctx.Value(batchItemKey{}).(*batchItem)
+	b.mtx.Lock()
+	if item == nil || item.done {
+		// an interceptor lost the context or called next twice, nothing to batch it with
+		b.mtx.Unlock()
+		return b.storage.Put(ctx, scn)
+	}
+	a := &arrival{item: item, scn: scn, res: make(chan putResult, 1)}
+	b.arrivals = append(b.arrivals, a)
+	item.done = true
+	b.pending--
+	last := b.pending == 0
+	b.mtx.Unlock()
+
+	if last {
+		b.flush()
+	}
+	res := <-a.res
+	return res.res, res.err
+}
+
+// leave - marks the scan as done if it never reached the storage
+func (b *batch) leave(item *batchItem) {
+	b.mtx.Lock()
+	if item.done {
+		b.mtx.Unlock()
+		return
+	}
+	item.done = true
+	b.pending--
+	last := b.pending == 0
+	b.mtx.Unlock()
+
+	if last {
+		b.flush()
+	}
+}
+
+// flush - writes the newest scan of every record, reports the results to every arrival
+func (b *batch) flush() {
+	b.mtx.Lock()
+	arrivals := b.arrivals
+	b.mtx.Unlock()
+
+	// the newest scan of every record wins, the latest in the batch if timestamps are equal
+	sort.Slice(arrivals, func(i, j int) bool { return arrivals[i].item.index < arrivals[j].item.index })
+	newest := map[uint64]*arrival{}
+	for _, a := range arrivals {
+		key := database.Hash(a.scn)
+		if cur, ok := newest[key]; !ok || a.scn.Timestamp() >= cur.scn.Timestamp() {
+			newest[key] = a
+		}
+	}
+	var (
+		winners []*arrival
+		scans   []database.Scan
+	)
+	for _, a := range arrivals {
+		if newest[database.Hash(a.scn)] != a {
+			a.res <- putResult{res: database.Result{Outcome: database.Stale}}
+			continue
+		}
+		winners = append(winners, a)
+		scans = append(scans, a.scn)
+	}
+	if len(winners) == 0 {
+		return
+	}
+
+	if batchStorage, ok := b.storage.(BatchStorage); ok {
+		results, err := batchStorage.PutBatch(b.ctx, scans)
+		for i, a := range winners {
+			if err != nil {
+				a.res <- putResult{err: err}
+				continue
+			}
+			a.res <- putResult{res: results[i]}
+		}
+		return
+	}
+	for _, a := range winners {
+		res, err := b.storage.Put(b.ctx, a.scn)
+		a.res <- putResult{res, err}
+	}
+}
@@ -0,0 +1,146 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/memory"
+)
+
+// batchStorageMock - records every PutBatch call
+type batchStorageMock struct {
+	*memory.Store
+	mtx     sync.Mutex
+	batches [][]database.Scan
+	err     error
+}
+
+func (bs *batchStorageMock) PutBatch(ctx context.Context, scans []database.Scan) ([]database.Result, error) {
+	bs.mtx.Lock()
+	bs.batches = append(bs.batches, scans)
+	bs.mtx.Unlock()
+	if bs.err != nil {
+		return nil, bs.err
+	}
+	return bs.Store.PutBatch(ctx, scans)
+}
+
+type BatchSuite struct {
+	suite.Suite
+}
+
+func TestBatchSuite(t *testing.T) {
+	suite.Run(t, &BatchSuite{})
+}
+
+func (s *BatchSuite) TestDeduplication() {
+	storage := &batchStorageMock{Store: memory.New()}
+	receiver, err := New(storage)
+	s.Require().NoError(err)
+
+	now := time.Now().Unix()
+	results := receiver.ProcessBatch(context.TODO(), []*ScanResult{
+		mustV2ScanResult("10.0.0.1", now-2, "first"),
+		mustV2ScanResult("10.0.0.1", now, "newest"),
+		mustV2ScanResult("10.0.0.2", now, "another record"),
+		mustV2ScanResult("10.0.0.1", now-1, "late"),
+		mustV2ScanResult("10.0.0.2", now, "same timestamp, later in the batch"),
+	})
+	s.Equal([]BatchResult{
+		{Result: database.Result{Outcome: database.Stale}},
+		{Result: database.Result{Outcome: database.Inserted}},
+		{Result: database.Result{Outcome: database.Stale}},
+		{Result: database.Result{Outcome: database.Stale}},
+		{Result: database.Result{Outcome: database.Inserted}},
+	}, results)
+
+	s.Require().Len(storage.batches, 1)
+	s.Len(storage.batches[0], 2)
+	rows, err := storage.GetAll(context.TODO())
+	s.NoError(err)
+	data := map[string]string{}
+	for _, row := range rows {
+		data[row.IP] = row.Data
+	}
+	s.Equal(map[string]string{"10.0.0.1": "newest", "10.0.0.2": "same timestamp, later in the batch"}, data)
+}
+
+func (s *BatchSuite) TestPerItemResults() {
+	storage := &batchStorageMock{Store: memory.New()}
+	var (
+		mtx   sync.Mutex
+		after = map[string]database.Outcome{}
+	)
+	receiver, err := New(storage,
+		WithValidator(NewValidator(DefaultValidationConfig())),
+		WithInterceptors(
+			Filter(func(scn *ScanResult) bool { return scn.IP() != "10.0.0.3" }),
+			func(ctx context.Context, scn *ScanResult, next Handler) (database.Result, error) {
+				res, err := next(ctx, scn.Annotate("batched", "yes"))
+				mtx.Lock()
+				after[scn.IP()] = res.Outcome
+				mtx.Unlock()
+				return res, err
+			},
+		))
+	s.Require().NoError(err)
+
+	now := time.Now().Unix()
+	results := receiver.ProcessBatch(context.TODO(), []*ScanResult{
+		mustV2ScanResult("10.0.0.1", now, "valid"),
+		nil,
+		mustV2ScanResult("not an ip", now, "invalid"),
+		mustV2ScanResult("10.0.0.3", now, "filtered"),
+		mustV2ScanResult("10.0.0.4", now, "valid too"),
+	})
+	s.Require().Len(results, 5)
+	s.Equal(BatchResult{Result: database.Result{Outcome: database.Inserted}}, results[0])
+	s.ErrorIs(results[1].Err, ErrEmptyResponse)
+	s.Equal(database.Rejection(string(ReasonUndecodable)), results[1].Result)
+	s.ErrorIs(results[2].Err, ErrInvalidScan)
+	s.Equal(database.Rejection(string(ReasonInvalidIP)), results[2].Result)
+	s.ErrorIs(results[3].Err, ErrDropped)
+	s.Equal(database.Rejection(string(ReasonDropped)), results[3].Result)
+	s.Equal(BatchResult{Result: database.Result{Outcome: database.Inserted}}, results[4])
+
+	// interceptors see the storage outcome of their own scan
+	s.Equal(map[string]database.Outcome{"10.0.0.1": database.Inserted, "10.0.0.4": database.Inserted}, after)
+	s.Require().Len(storage.batches, 1)
+	s.Len(storage.batches[0], 2)
+	s.Equal(map[string]string{"batched": "yes"}, database.FieldsOf(storage.batches[0][0]))
+}
+
+func (s *BatchSuite) TestStorageErrors() {
+	now := time.Now().Unix()
+	batchErr := errors.New("deadlock found")
+	storage := &batchStorageMock{Store: memory.New(), err: batchErr}
+	receiver, err := New(storage)
+	s.Require().NoError(err)
+
+	// a failed batch fails every written scan, superseded ones are fine
+	results := receiver.ProcessBatch(context.TODO(), []*ScanResult{
+		mustV2ScanResult("10.0.0.1", now-1, "old"),
+		mustV2ScanResult("10.0.0.1", now, "new"),
+		mustV2ScanResult("10.0.0.2", now, "other"),
+	})
+	s.Equal([]BatchResult{{Result: database.Result{Outcome: database.Stale}}, {Err: batchErr}, {Err: batchErr}}, results)
+
+	// storage without batch support - scans are written one by one
+	mock := &storageMock{data: map[uint64]database.Scan{}}
+	receiver, err = New(mock)
+	s.Require().NoError(err)
+	results = receiver.ProcessBatch(context.TODO(), []*ScanResult{
+		mustV2ScanResult("10.0.0.1", now, "new"),
+		mustV2ScanResult("10.0.0.2", now, "other"),
+	})
+	s.Equal([]BatchResult{{Result: database.Result{Outcome: database.Inserted}}, {Result: database.Result{Outcome: database.Inserted}}}, results)
+	s.Len(mock.data, 2)
+
+	s.Empty(receiver.ProcessBatch(context.TODO(), nil))
+}
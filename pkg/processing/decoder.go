@@ -0,0 +1,267 @@
+package processing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
+// Decoding error kinds, every decoding failure matches exactly one of them with errors.Is
+var (
+	// ErrUnsupportedVersion - no decoder is registered for the scan data version
+	ErrUnsupportedVersion = errors.New("unsupported data version")
+	// ErrMalformedPayload - the scan data cannot be decoded
+	ErrMalformedPayload = errors.New("malformed payload")
+	// ErrEmptyResponse - the scan data carries no service response
+	ErrEmptyResponse = errors.New("empty response")
+)
+
+// DecodeError - scan data decoding failure
+type DecodeError struct {
+	Version uint8
+	// Kind - one of ErrUnsupportedVersion, ErrMalformedPayload or ErrEmptyResponse
+	Kind error
+	// Err - the underlying cause, if any
+	Err error
+}
+
+// Error - error message
+func (e *DecodeError) Error() string {
+	if e.Err == nil || e.Err == e.Kind {
+		return fmt.Sprintf("cannot decode data version %d: %s", e.Version, e.Kind)
+	}
+	return fmt.Sprintf("cannot decode data version %d: %s: %s", e.Version, e.Kind, e.Err)
+}
+
+// Unwrap - makes both the kind and the cause available to errors.Is and errors.As
+func (e *DecodeError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Decoder - decodes JSON scan data of a single data version into the raw service response bytes,
+// errors should wrap ErrMalformedPayload or ErrEmptyResponse, any other error is treated as a malformed payload
+type Decoder interface {
+	Decode(data []byte) ([]byte, error)
+}
+
+// DecoderFunc - adapter to use ordinary functions as Decoder
+type DecoderFunc func(data []byte) ([]byte, error)
+
+// Decode - calls f(data)
+func (f DecoderFunc) Decode(data []byte) ([]byte, error) {
+	return f(data)
+}
+
+// DetailsDecoder - Decoder of data versions which carry the details of the exchange besides the response (V3),
+// details are nil if the data has none
+type DetailsDecoder interface {
+	Decoder
+	DecodeDetails(data []byte) ([]byte, *scanning.Details, error)
+}
+
+// ValueDecoder - Decoder of data versions which also have a protobuf representation (V1, V2 and V3),
+// it takes the data already decoded by the wire format (see scanning.Scan.Decoded), so it's not decoded twice
+type ValueDecoder interface {
+	Decoder
+	DecodeValue(data any) ([]byte, *scanning.Details, error)
+}
+
+// Registry - decoders keyed by data version
+type Registry struct {
+	mtx      sync.RWMutex
+	decoders map[uint8]Decoder
+}
+
+// NewRegistry - Registry constructor, the registry is empty
+func NewRegistry() *Registry {
+	return &Registry{decoders: map[uint8]Decoder{}}
+}
+
+// DefaultRegistry - registry used by ScanResult and Receiver, comes with V1, V2 and V3 decoders
+var DefaultRegistry = NewRegistry()
+
+func init() {
+	MustRegister(scanning.V1, v1Decoder{})
+	MustRegister(scanning.V2, v2Decoder{})
+	MustRegister(scanning.V3, v3Decoder{})
+}
+
+// Register - registers the decoder of a data version, versions cannot be registered twice
+func (r *Registry) Register(version uint8, d Decoder) error {
+	if d == nil {
+		return fmt.Errorf("cannot register nil decoder for data version %d", version)
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.decoders[version]; ok {
+		return fmt.Errorf("decoder for data version %d is already registered", version)
+	}
+	r.decoders[version] = d
+	return nil
+}
+
+// Supports - true if there is a decoder for the data version
+func (r *Registry) Supports(version uint8) bool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	_, ok := r.decoders[version]
+	return ok
+}
+
+// Decode - decodes the data with the decoder of the data version, all errors are *DecodeError
+func (r *Registry) Decode(version uint8, data []byte) ([]byte, error) {
+	res, _, err := r.DecodeDetails(version, data)
+	return res, err
+}
+
+// DecodeDetails - like Decode, but also returns the details of the exchange if the decoder is a DetailsDecoder
+func (r *Registry) DecodeDetails(version uint8, data []byte) ([]byte, *scanning.Details, error) {
+	r.mtx.RLock()
+	d, ok := r.decoders[version]
+	r.mtx.RUnlock()
+	if !ok {
+		return nil, nil, &DecodeError{Version: version, Kind: ErrUnsupportedVersion}
+	}
+	var (
+		res     []byte
+		details *scanning.Details
+		err     error
+	)
+	if dd, ok := d.(DetailsDecoder); ok {
+		res, details, err = dd.DecodeDetails(data)
+	} else {
+		res, err = d.Decode(data)
+	}
+	if err != nil {
+		return nil, nil, decodeError(version, err)
+	}
+	return res, details, nil
+}
+
+// DecodeValue - like DecodeDetails, but the data is already decoded by the wire format (see scanning.Scan.Decoded),
+// the decoder of the data version must be a ValueDecoder
+func (r *Registry) DecodeValue(version uint8, data any) ([]byte, *scanning.Details, error) {
+	r.mtx.RLock()
+	d, ok := r.decoders[version]
+	r.mtx.RUnlock()
+	vd, isValue := d.(ValueDecoder)
+	if !ok || !isValue {
+		return nil, nil, &DecodeError{Version: version, Kind: ErrUnsupportedVersion}
+	}
+	res, details, err := vd.DecodeValue(data)
+	if err != nil {
+		return nil, nil, decodeError(version, err)
+	}
+	return res, details, nil
+}
+
+// decodeError - *DecodeError of the decoder error
+func decodeError(version uint8, err error) *DecodeError {
+	if errors.Is(err, ErrEmptyResponse) {
+		return &DecodeError{Version: version, Kind: ErrEmptyResponse, Err: err}
+	}
+	return &DecodeError{Version: version, Kind: ErrMalformedPayload, Err: err}
+}
+
+// Register - registers the decoder of a data version in DefaultRegistry
+func Register(version uint8, d Decoder) error {
+	return DefaultRegistry.Register(version, d)
+}
+
+// MustRegister - like Register, but panics on error, meant for init functions
+func MustRegister(version uint8, d Decoder) {
+	if err := Register(version, d); err != nil {
+		panic(err)
+	}
+}
+
+// v1Decoder - older - base64 encoded bytes, which are not necessarily UTF-8 despite the field name
+type v1Decoder struct{}
+
+// Decode - response bytes of the JSON data
+func (v1Decoder) Decode(data []byte) ([]byte, error) {
+	var v1Data scanning.V1Data
+	if err := json.Unmarshal(data, &v1Data); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedPayload, err)
+	}
+	res, _, err := v1Decoder{}.DecodeValue(&v1Data)
+	return res, err
+}
+
+// DecodeValue - response bytes of *scanning.V1Data
+func (v1Decoder) DecodeValue(data any) ([]byte, *scanning.Details, error) {
+	v1Data, ok := data.(*scanning.V1Data)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: unexpected data %T", ErrMalformedPayload, data)
+	}
+	if len(v1Data.ResponseBytesUtf8) == 0 {
+		return nil, nil, ErrEmptyResponse
+	}
+	return v1Data.ResponseBytesUtf8, nil, nil
+}
+
+// v2Decoder - newer - decoded string
+type v2Decoder struct{}
+
+// Decode - response bytes of the JSON data
+func (v2Decoder) Decode(data []byte) ([]byte, error) {
+	var v2Data scanning.V2Data
+	if err := json.Unmarshal(data, &v2Data); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedPayload, err)
+	}
+	res, _, err := v2Decoder{}.DecodeValue(&v2Data)
+	return res, err
+}
+
+// DecodeValue - response bytes of *scanning.V2Data
+func (v2Decoder) DecodeValue(data any) ([]byte, *scanning.Details, error) {
+	v2Data, ok := data.(*scanning.V2Data)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: unexpected data %T", ErrMalformedPayload, data)
+	}
+	if v2Data.ResponseStr == "" {
+		return nil, nil, ErrEmptyResponse
+	}
+	return []byte(v2Data.ResponseStr), nil, nil
+}
+
+// v3Decoder - structured - raw response bytes along with the details of the exchange
+type v3Decoder struct{}
+
+// Decode - response bytes only
+func (v3Decoder) Decode(data []byte) ([]byte, error) {
+	res, _, err := v3Decoder{}.DecodeDetails(data)
+	return res, err
+}
+
+// DecodeDetails - response bytes and the details of the exchange
+func (v3Decoder) DecodeDetails(data []byte) ([]byte, *scanning.Details, error) {
+	var v3Data scanning.V3Data
+	if err := json.Unmarshal(data, &v3Data); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrMalformedPayload, err)
+	}
+	return v3Decoder{}.DecodeValue(&v3Data)
+}
+
+// DecodeValue - response bytes and the details of the exchange of *scanning.V3Data
+func (v3Decoder) DecodeValue(data any) ([]byte, *scanning.Details, error) {
+	v3Data, ok := data.(*scanning.V3Data)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: unexpected data %T", ErrMalformedPayload, data)
+	}
+	switch v3Data.Transport {
+	case scanning.TransportTCP, scanning.TransportUDP:
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown transport %q", ErrMalformedPayload, v3Data.Transport)
+	}
+	if v3Data.LatencyMicros < 0 {
+		return nil, nil, fmt.Errorf("%w: negative latency %d", ErrMalformedPayload, v3Data.LatencyMicros)
+	}
+	if len(v3Data.Response) == 0 {
+		return nil, nil, ErrEmptyResponse
+	}
+	return v3Data.Response, &v3Data.Details, nil
+}
@@ -0,0 +1,137 @@
+package processing_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/processing"
+	"github.com/igorvan/scan-takehome/pkg/processing/decodertest"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
+type DecoderSuite struct {
+	suite.Suite
+}
+
+func TestDecoderSuite(t *testing.T) {
+	suite.Run(t, &DecoderSuite{})
+}
+
+func (s *DecoderSuite) TestBuiltinDecoders() {
+	decodertest.RunRegistered(s.T(), processing.DefaultRegistry, scanning.V1, []decodertest.Case{
+		{Name: "Good", Data: scanning.V1Data{ResponseBytesUtf8: []byte("hello world")}, Expected: "hello world"},
+		{Name: "README example", Data: []byte(`{"response_bytes_utf8":"aGVsbG8gd29ybGQ="}`), Expected: "hello world"},
+		{Name: "Not UTF-8", Data: scanning.V1Data{ResponseBytesUtf8: []byte("caf\xe9\x00\xff")}, Expected: "caf\xe9\x00\xff"},
+		{Name: "Empty", Data: scanning.V1Data{}, WantKind: processing.ErrEmptyResponse},
+		{Name: "Not base64", Data: []byte(`{"response_bytes_utf8":"%%%"}`), WantKind: processing.ErrMalformedPayload},
+	})
+	decodertest.RunRegistered(s.T(), processing.DefaultRegistry, scanning.V2, []decodertest.Case{
+		{Name: "Good", Data: scanning.V2Data{ResponseStr: "hello world"}, Expected: "hello world"},
+		{Name: "Empty", Data: scanning.V2Data{}, WantKind: processing.ErrEmptyResponse},
+		{Name: "Wrong type", Data: []byte(`{"response_str":42}`), WantKind: processing.ErrMalformedPayload},
+	})
+	decodertest.RunRegistered(s.T(), processing.DefaultRegistry, scanning.V3, []decodertest.Case{
+		{Name: "Good", Data: scanning.V3Data{Response: []byte("hello world"), Details: scanning.Details{Transport: scanning.TransportTCP}},
+			Expected: "hello world"},
+		{Name: "Binary", Data: scanning.V3Data{Response: []byte{0x12, 0x34, 0x81, 0x80}, Details: scanning.Details{Transport: scanning.TransportUDP}},
+			Expected: "\x12\x34\x81\x80"},
+		{Name: "Empty", Data: scanning.V3Data{Details: scanning.Details{Transport: scanning.TransportUDP}}, WantKind: processing.ErrEmptyResponse},
+		{Name: "No transport", Data: scanning.V3Data{Response: []byte("hello world")}, WantKind: processing.ErrMalformedPayload},
+		{Name: "Unknown transport", Data: []byte(`{"response":"aGk=","transport":"sctp"}`), WantKind: processing.ErrMalformedPayload},
+		{Name: "Negative latency", Data: []byte(`{"response":"aGk=","transport":"tcp","latency_us":-1}`),
+			WantKind: processing.ErrMalformedPayload},
+		{Name: "Broken section", Data: []byte(`{"response":"aGk=","transport":"tcp","sections":{"http":}}`),
+			WantKind: processing.ErrMalformedPayload},
+	})
+}
+
+func (s *DecoderSuite) TestV3Details() {
+	data := []byte(`{
+		"transport": "tcp",
+		"request": "R0VUIC8gSFRUUC8xLjENCg0K",
+		"response": "SFRUUC8xLjEgMjAwIE9LDQoNCg==",
+		"truncated": true,
+		"latency_us": 2500,
+		"tls": {"version": "TLS 1.3", "cipher_suite": "TLS_AES_128_GCM_SHA256", "server_name": "example.com", "alpn": "http/1.1"},
+		"sections": {"http": {"redirects": 0}}
+	}`)
+	res, details, err := processing.DefaultRegistry.DecodeDetails(scanning.V3, data)
+	s.Require().NoError(err)
+	s.Equal("HTTP/1.1 200 OK\r\n\r\n", string(res))
+	s.Equal(scanning.TransportTCP, details.Transport)
+	s.Equal("GET / HTTP/1.1\r\n\r\n", string(details.Request))
+	s.True(details.Truncated)
+	s.EqualValues(2500, details.LatencyMicros)
+	s.Equal(&scanning.TLSInfo{Version: "TLS 1.3", CipherSuite: "TLS_AES_128_GCM_SHA256", ServerName: "example.com", ALPN: "http/1.1"},
+		details.TLS)
+	s.JSONEq(`{"redirects": 0}`, string(details.Sections["http"]))
+
+	// older versions carry no details
+	res, details, err = processing.DefaultRegistry.DecodeDetails(scanning.V2, []byte(`{"response_str":"hello"}`))
+	s.NoError(err)
+	s.Equal("hello", string(res))
+	s.Nil(details)
+}
+
+func (s *DecoderSuite) TestDecodeValue() {
+	// protobuf messages come already decoded, they are validated like JSON ones
+	scan := &scanning.Scan{Ip: "1.1.1.1", Port: 443, Service: "HTTP", Timestamp: 100, DataVersion: scanning.V3,
+		Decoded: &scanning.V3Data{Response: []byte("HTTP/1.1 200 OK\r\n\r\n"), Details: scanning.Details{Transport: scanning.TransportTCP}}}
+	b, err := scanning.Marshal(scanning.ContentTypeProtobuf, scan)
+	s.Require().NoError(err)
+	received := &scanning.Scan{}
+	s.Require().NoError(scanning.Unmarshal(scanning.ContentTypeProtobuf, b, received))
+	res, err := processing.ScanResultOf(received)
+	s.Require().NoError(err)
+	s.Equal("HTTP/1.1 200 OK\r\n\r\n", res.Data())
+	s.Equal(scanning.TransportTCP, res.Details().Transport)
+	s.Equal("200", res.Fields()["status_code"])
+
+	for name, tc := range map[string]struct {
+		version uint8
+		data    any
+		kind    error
+	}{
+		"empty V1":          {scanning.V1, &scanning.V1Data{}, processing.ErrEmptyResponse},
+		"empty V2":          {scanning.V2, &scanning.V2Data{}, processing.ErrEmptyResponse},
+		"unknown transport": {scanning.V3, &scanning.V3Data{Response: []byte("hi"), Details: scanning.Details{Transport: "sctp"}}, processing.ErrMalformedPayload},
+		"mismatched data":   {scanning.V2, &scanning.V1Data{ResponseBytesUtf8: []byte("hi")}, processing.ErrMalformedPayload},
+		"no wire format":    {42, &scanning.V2Data{ResponseStr: "hi"}, processing.ErrUnsupportedVersion},
+	} {
+		_, _, err := processing.DefaultRegistry.DecodeValue(tc.version, tc.data)
+		s.ErrorIs(err, tc.kind, name)
+	}
+	res2, details, err := processing.DefaultRegistry.DecodeValue(scanning.V1, &scanning.V1Data{ResponseBytesUtf8: []byte("caf\xe9")})
+	s.NoError(err)
+	s.Equal("caf\xe9", string(res2))
+	s.Nil(details)
+}
+
+func (s *DecoderSuite) TestRegistry() {
+	r := processing.NewRegistry()
+	_, err := r.Decode(7, []byte(`{}`))
+	s.True(errors.Is(err, processing.ErrUnsupportedVersion))
+
+	// errors of third-party decoders which don't say what's wrong are treated as malformed payloads
+	s.NoError(r.Register(9, processing.DecoderFunc(func([]byte) ([]byte, error) {
+		return nil, fmt.Errorf("nope")
+	})))
+	_, err = r.Decode(9, []byte(`{}`))
+	s.True(errors.Is(err, processing.ErrMalformedPayload))
+
+	upper := processing.DecoderFunc(func(data []byte) ([]byte, error) {
+		return append([]byte("decoded "), data...), nil
+	})
+	s.NoError(r.Register(7, upper))
+	s.Error(r.Register(7, upper), "versions cannot be registered twice")
+	s.Error(r.Register(8, nil))
+	s.True(r.Supports(7))
+	s.False(r.Supports(8))
+
+	res, err := r.Decode(7, []byte(`{}`))
+	s.NoError(err)
+	s.Equal("decoded {}", string(res))
+}
@@ -0,0 +1,99 @@
+// Package decodertest - test kit for processing.Decoder authors
+package decodertest
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/igorvan/scan-takehome/pkg/processing"
+)
+
+// Case - a single decoder test case
+type Case struct {
+	Name string
+	// Data - scan data, marshalled into JSON unless it's already []byte or json.RawMessage
+	Data any
+	// Expected - decoded service response bytes, ignored if WantErr is set
+	Expected string
+	WantErr  bool
+	// WantKind - expected error kind (e.g. processing.ErrEmptyResponse), implies WantErr
+	WantKind error
+}
+
+// garbage - inputs every decoder must survive without panicking
+var garbage = [][]byte{
+	nil,
+	[]byte(""),
+	[]byte("null"),
+	[]byte("{}"),
+	[]byte("[]"),
+	[]byte(`"string"`),
+	[]byte("42"),
+	[]byte("{\"unterminated"),
+	{0xff, 0xfe, 0x00},
+}
+
+// Run - checks the decoder against the provided cases and against garbage inputs,
+// which may fail to decode but must never panic
+func Run(t *testing.T, d processing.Decoder, cases []Case) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			res, err := d.Decode(encode(t, tc.Data))
+			if tc.WantErr || tc.WantKind != nil {
+				if err == nil {
+					t.Fatalf("expected an error, got response %q", res)
+				}
+				if tc.WantKind != nil && !errors.Is(err, tc.WantKind) {
+					t.Fatalf("expected %q error, got %q", tc.WantKind, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if string(res) != tc.Expected {
+				t.Fatalf("expected response %q, got %q", tc.Expected, res)
+			}
+		})
+	}
+	t.Run("Garbage", func(t *testing.T) {
+		for _, input := range garbage {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Fatalf("decoder panicked on %q: %v", input, r)
+					}
+				}()
+				_, _ = d.Decode(input)
+			}()
+		}
+	})
+}
+
+// RunRegistered - like Run, but goes through the decoder registered for the version in the registry
+func RunRegistered(t *testing.T, r *processing.Registry, version uint8, cases []Case) {
+	t.Helper()
+	if !r.Supports(version) {
+		t.Fatalf("no decoder registered for data version %d", version)
+	}
+	Run(t, processing.DecoderFunc(func(data []byte) ([]byte, error) {
+		return r.Decode(version, data)
+	}), cases)
+}
+
+func encode(t *testing.T, data any) []byte {
+	t.Helper()
+	switch d := data.(type) {
+	case []byte:
+		return d
+	case json.RawMessage:
+		return d
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("cannot marshal test data: %s", err)
+	}
+	return b
+}
@@ -0,0 +1,120 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// ErrDispatcherClosed - the dispatcher doesn't accept scans anymore
+var ErrDispatcherClosed = errors.New("dispatcher is closed")
+
+// job - a scan waiting for its worker
+type job struct {
+	ctx  context.Context
+	scn  *ScanResult
+	done func(res database.Result, err error)
+}
+
+// Dispatcher - runs Receiver.Process on a bounded pool of workers, scans of the same record
+// (same service, IP and port) always go to the same worker, so they are processed one at a time and in submission order,
+// while scans of different records are processed concurrently
+// every worker has a bounded queue, submitting into a full queue blocks, which slows the message source down
+type Dispatcher struct {
+	receiver *Receiver
+	queues   []chan job
+	mtx      sync.RWMutex
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewDispatcher - Dispatcher constructor, starts the workers right away
+func NewDispatcher(receiver *Receiver, workers, queueSize int) (*Dispatcher, error) {
+	if receiver == nil {
+		return nil, fmt.Errorf("cannot instantiate Dispatcher, no receiver provided")
+	}
+	if workers <= 0 {
+		return nil, fmt.Errorf("cannot instantiate Dispatcher with %d workers", workers)
+	}
+	if queueSize < 0 {
+		return nil, fmt.Errorf("cannot instantiate Dispatcher with negative queue size %d", queueSize)
+	}
+	d := &Dispatcher{receiver: receiver, queues: make([]chan job, workers)}
+	for i := range d.queues {
+		d.queues[i] = make(chan job, queueSize)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+	return d, nil
+}
+
+// Submit - queues the scan for processing, done is called by the worker with the Receiver.Process result
+// blocks while the worker queue is full, returns ctx error if ctx is done before the scan is queued
+func (d *Dispatcher) Submit(ctx context.Context, scn *ScanResult, done func(res database.Result, err error)) error {
+	if scn == nil {
+		return &DecodeError{Kind: ErrEmptyResponse}
+	}
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	if d.closed {
+		return ErrDispatcherClosed
+	}
+	select {
+	case d.queues[database.Hash(scn)%uint64(len(d.queues))] <- job{ctx: ctx, scn: scn, done: done}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dispatch - like Receiver.Process, but processed by the record's worker, waits for the result
+func (d *Dispatcher) Dispatch(ctx context.Context, scn *ScanResult) (database.Result, error) {
+	type result struct {
+		res database.Result
+		err error
+	}
+	res := make(chan result, 1)
+	if err := d.Submit(ctx, scn, func(r database.Result, err error) { res <- result{r, err} }); err != nil {
+		return resultOf(database.Result{}, err)
+	}
+	// no waiting for ctx here - the worker always reports back, and quickly if ctx is done
+	r := <-res
+	return r.res, r.err
+}
+
+// Pending - number of queued scans
+func (d *Dispatcher) Pending() int {
+	n := 0
+	for _, q := range d.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// Close - stops accepting scans, waits for the queued ones to be processed
+func (d *Dispatcher) Close() {
+	d.mtx.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, q := range d.queues {
+			close(q)
+		}
+	}
+	d.mtx.Unlock()
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) work(queue <-chan job) {
+	defer d.wg.Done()
+	for j := range queue {
+		// the submitter has given up on the scan while it was queued
+		if err := j.ctx.Err(); err != nil {
+			j.done(database.Result{}, err)
+			continue
+		}
+		j.done(d.receiver.Process(j.ctx, j.scn))
+	}
+}
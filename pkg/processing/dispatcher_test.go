@@ -0,0 +1,180 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// slowStorage - records per-record concurrency and the order of writes, blocks writes while gate is closed
+type slowStorage struct {
+	mtx         sync.Mutex
+	inFlight    map[uint64]int
+	maxPerKey   int
+	total       int
+	maxTotal    int
+	order       map[uint64][]int64
+	gate        chan struct{}
+	delay       time.Duration
+	started     chan struct{}
+	startedOnce sync.Once
+}
+
+func newSlowStorage(delay time.Duration) *slowStorage {
+	return &slowStorage{inFlight: map[uint64]int{}, order: map[uint64][]int64{}, delay: delay, started: make(chan struct{})}
+}
+
+func (st *slowStorage) Put(_ context.Context, scan database.Scan) (database.Result, error) {
+	key := database.Hash(scan)
+	st.mtx.Lock()
+	st.inFlight[key]++
+	st.total++
+	st.maxPerKey = max(st.maxPerKey, st.inFlight[key])
+	st.maxTotal = max(st.maxTotal, st.total)
+	st.order[key] = append(st.order[key], scan.Timestamp())
+	st.mtx.Unlock()
+	st.startedOnce.Do(func() { close(st.started) })
+
+	if st.gate != nil {
+		<-st.gate
+	}
+	time.Sleep(st.delay)
+
+	st.mtx.Lock()
+	st.inFlight[key]--
+	st.total--
+	st.mtx.Unlock()
+	return database.Result{Outcome: database.Inserted}, nil
+}
+
+type DispatcherSuite struct {
+	suite.Suite
+}
+
+func TestDispatcherSuite(t *testing.T) {
+	suite.Run(t, &DispatcherSuite{})
+}
+
+func (s *DispatcherSuite) TestPerKeySerialization() {
+	const workers = 4
+	storage := newSlowStorage(time.Millisecond)
+	receiver, err := New(storage)
+	s.Require().NoError(err)
+	d, err := NewDispatcher(receiver, workers, 8)
+	s.Require().NoError(err)
+	defer d.Close()
+
+	// one record per worker, so records are guaranteed to be processed concurrently
+	var ips []string
+	seen := map[uint64]bool{}
+	for i := 0; len(ips) < workers; i++ {
+		ip := fmt.Sprintf("10.0.0.%d", i)
+		worker := database.Hash(mustV2ScanResult(ip, 1, "hello")) % workers
+		if !seen[worker] {
+			seen[worker] = true
+			ips = append(ips, ip)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, ip := range ips {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ts := int64(1); ts <= 20; ts++ {
+				// fire and forget - the order of submission is the order of processing
+				s.NoError(d.Submit(context.Background(), mustV2ScanResult(ip, ts, "hello"), func(database.Result, error) {}))
+			}
+		}()
+	}
+	wg.Wait()
+	d.Close()
+
+	s.Equal(1, storage.maxPerKey)
+	s.Greater(storage.maxTotal, 1)
+	s.Len(storage.order, workers)
+	for _, order := range storage.order {
+		s.Len(order, 20)
+		s.IsIncreasing(order)
+	}
+}
+
+func (s *DispatcherSuite) TestDispatch() {
+	storage := newSlowStorage(0)
+	receiver, err := New(storage, WithValidator(NewValidator(DefaultValidationConfig())))
+	s.Require().NoError(err)
+	d, err := NewDispatcher(receiver, 2, 0)
+	s.Require().NoError(err)
+	defer d.Close()
+
+	res, err := d.Dispatch(context.TODO(), mustV2ScanResult("10.0.0.1", time.Now().Unix(), "hello"))
+	s.NoError(err)
+	s.Equal(database.Inserted, res.Outcome)
+
+	// Receiver errors are reported as they are
+	_, err = d.Dispatch(context.TODO(), mustV2ScanResult("not an ip", time.Now().Unix(), "hello"))
+	s.ErrorIs(err, ErrInvalidScan)
+
+	_, err = d.Dispatch(context.TODO(), nil)
+	s.ErrorIs(err, ErrEmptyResponse)
+}
+
+func (s *DispatcherSuite) TestBackpressure() {
+	storage := newSlowStorage(0)
+	storage.gate = make(chan struct{})
+	receiver, err := New(storage)
+	s.Require().NoError(err)
+	d, err := NewDispatcher(receiver, 1, 1)
+	s.Require().NoError(err)
+
+	results := make(chan error, 3)
+	done := func(_ database.Result, err error) { results <- err }
+	// the first scan is taken by the worker, the second one waits in the queue
+	s.NoError(d.Submit(context.TODO(), mustV2ScanResult("10.0.0.1", 1, "hello"), done))
+	<-storage.started
+	s.NoError(d.Submit(context.TODO(), mustV2ScanResult("10.0.0.1", 2, "hello"), done))
+	s.Equal(1, d.Pending())
+
+	// the queue is full - the source is blocked until the context expires
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	s.ErrorIs(d.Submit(ctx, mustV2ScanResult("10.0.0.1", 3, "hello"), done), context.DeadlineExceeded)
+
+	close(storage.gate)
+	s.NoError(<-results)
+	s.NoError(<-results)
+
+	d.Close()
+	s.ErrorIs(d.Submit(context.TODO(), mustV2ScanResult("10.0.0.1", 4, "hello"), done), ErrDispatcherClosed)
+	s.Equal([]int64{1, 2}, storage.order[database.Hash(mustV2ScanResult("10.0.0.1", 1, "hello"))])
+}
+
+func (s *DispatcherSuite) TestCanceledWhileQueued() {
+	storage := newSlowStorage(0)
+	storage.gate = make(chan struct{})
+	receiver, err := New(storage)
+	s.Require().NoError(err)
+	d, err := NewDispatcher(receiver, 1, 1)
+	s.Require().NoError(err)
+	defer d.Close()
+
+	first := make(chan error, 1)
+	s.NoError(d.Submit(context.TODO(), mustV2ScanResult("10.0.0.1", 1, "hello"), func(_ database.Result, err error) { first <- err }))
+	<-storage.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	second := make(chan error, 1)
+	s.NoError(d.Submit(ctx, mustV2ScanResult("10.0.0.1", 2, "hello"), func(_ database.Result, err error) { second <- err }))
+	cancel()
+	close(storage.gate)
+
+	s.NoError(<-first)
+	s.ErrorIs(<-second, context.Canceled)
+	s.Len(storage.order[database.Hash(mustV2ScanResult("10.0.0.1", 1, "hello"))], 1)
+}
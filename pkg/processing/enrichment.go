@@ -0,0 +1,176 @@
+package processing
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// Enrichment fields stored with the record
+const (
+	FieldASN     = "geo.asn"
+	FieldOrg     = "geo.org"
+	FieldCountry = "geo.country"
+)
+
+// Network - IP range of a network owner
+type Network struct {
+	Prefix netip.Prefix
+	ASN    uint32
+	Org    string
+	// Country - ISO 3166-1 alpha-2 country code
+	Country string
+}
+
+// GeoDB - immutable IP range database, lookups pick the most specific (longest) matching prefix
+type GeoDB struct {
+	// networks by prefix length, separately for IPv4 and IPv6
+	v4   [33]map[netip.Prefix]*Network
+	v6   [129]map[netip.Prefix]*Network
+	size int
+}
+
+// LoadGeoCSV - reads the database from CSV lines of network,asn,org,country (e.g. 1.1.1.0/24,13335,Cloudflare,AU),
+// empty lines, lines starting with # and a network,asn,org,country header line are ignored
+func LoadGeoCSV(r io.Reader) (*GeoDB, error) {
+	db := &GeoDB{}
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 4
+	cr.TrimLeadingSpace = true
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if line == 1 && strings.EqualFold(rec[0], "network") {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(rec[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(rec[1]), "AS"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad ASN %q", line, rec[1])
+		}
+		// IPv4-mapped IPv6 networks (::ffff:1.1.1.0/120) are stored as IPv4 ones, lookups unmap addresses too
+		if prefix.Addr().Is4In6() {
+			if prefix.Bits() < 96 {
+				return nil, fmt.Errorf("line %d: IPv4-mapped network %s spans beyond IPv4", line, prefix)
+			}
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefix = prefix.Masked()
+		byLen := db.v4[:]
+		if prefix.Addr().Is6() {
+			byLen = db.v6[:]
+		}
+		if byLen[prefix.Bits()] == nil {
+			byLen[prefix.Bits()] = map[netip.Prefix]*Network{}
+		}
+		if _, ok := byLen[prefix.Bits()][prefix]; !ok {
+			db.size++
+		}
+		byLen[prefix.Bits()][prefix] = &Network{Prefix: prefix, ASN: uint32(asn), Org: rec[2], Country: strings.ToUpper(rec[3])}
+	}
+	return db, nil
+}
+
+// Lookup - the most specific network containing the IP address
+func (db *GeoDB) Lookup(ip string) (*Network, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, false
+	}
+	addr = addr.Unmap().WithZone("")
+	byLen := db.v4[:]
+	if addr.Is6() {
+		byLen = db.v6[:]
+	}
+	for bits := len(byLen) - 1; bits >= 0; bits-- {
+		if byLen[bits] == nil {
+			continue
+		}
+		prefix, _ := addr.Prefix(bits)
+		if network, ok := byLen[bits][prefix]; ok {
+			return network, true
+		}
+	}
+	return nil, false
+}
+
+// Len - number of networks in the database
+func (db *GeoDB) Len() int {
+	return db.size
+}
+
+// Enricher - annotates scans with the owner and location of their IP address (see Interceptor),
+// the database file can be replaced at any time, it's picked up by Reload or Watch
+type Enricher struct {
+	db       *watchedFile[GeoDB]
+	enriched atomic.Uint64
+}
+
+// NewEnricher - Enricher constructor, loads the CSV database file (see LoadGeoCSV)
+func NewEnricher(path string, log database.Logger) (*Enricher, error) {
+	db, err := watchFile(path, "GeoIP database", LoadGeoCSV, func(db *GeoDB) string {
+		return fmt.Sprintf("%d networks", db.Len())
+	}, log)
+	if err != nil {
+		return nil, err
+	}
+	return &Enricher{db: db}, nil
+}
+
+// Reload - re-reads the database file, the current database stays in use if the file cannot be loaded
+func (e *Enricher) Reload() error {
+	return e.db.Reload()
+}
+
+// Watch - reloads the database whenever its file is modified, checks every interval until ctx is done
+func (e *Enricher) Watch(ctx context.Context, interval time.Duration) {
+	e.db.Watch(ctx, interval)
+}
+
+// Lookup - the most specific network of the IP address in the current database
+func (e *Enricher) Lookup(ip string) (*Network, bool) {
+	return e.db.Load().Lookup(ip)
+}
+
+// Enriched - number of scans annotated so far
+func (e *Enricher) Enriched() uint64 {
+	return e.enriched.Load()
+}
+
+// Interceptor - annotates scans with FieldASN, FieldOrg and FieldCountry, scans of unknown networks are passed as they are
+func (e *Enricher) Interceptor() Interceptor {
+	return func(ctx context.Context, scn *ScanResult, next Handler) (database.Result, error) {
+		network, ok := e.Lookup(scn.IP())
+		if !ok {
+			return next(ctx, scn)
+		}
+		e.enriched.Add(1)
+		scn = scn.Annotate(FieldASN, strconv.FormatUint(uint64(network.ASN), 10))
+		if network.Org != "" {
+			scn = scn.Annotate(FieldOrg, network.Org)
+		}
+		if network.Country != "" {
+			scn = scn.Annotate(FieldCountry, network.Country)
+		}
+		return next(ctx, scn)
+	}
+}
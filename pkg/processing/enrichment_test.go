@@ -0,0 +1,134 @@
+package processing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
+const testGeoCSV = `network,asn,org,country
+# comments are fine
+10.0.0.0/8,64512,Private Corp,us
+10.10.0.0/16,AS64513,"Branch Office, Inc.",DE
+2001:db8::/32,64514,Docs,NL
+::ffff:172.16.0.0/108,64515,Mapped,FR
+`
+
+type EnrichmentSuite struct {
+	suite.Suite
+}
+
+func TestEnrichmentSuite(t *testing.T) {
+	suite.Run(t, &EnrichmentSuite{})
+}
+
+func (s *EnrichmentSuite) writeDB(path, content string) {
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+}
+
+func (s *EnrichmentSuite) TestLookup() {
+	db, err := LoadGeoCSV(strings.NewReader(testGeoCSV))
+	s.Require().NoError(err)
+	s.Equal(4, db.Len())
+
+	testCases := []struct {
+		ip      string
+		asn     uint32
+		org     string
+		country string
+	}{
+		{ip: "10.1.2.3", asn: 64512, org: "Private Corp", country: "US"},
+		{ip: "10.10.10.10", asn: 64513, org: "Branch Office, Inc.", country: "DE"},
+		{ip: "::ffff:10.10.1.1", asn: 64513, org: "Branch Office, Inc.", country: "DE"},
+		{ip: "2001:db8::1", asn: 64514, org: "Docs", country: "NL"},
+		{ip: "172.16.5.5", asn: 64515, org: "Mapped", country: "FR"},
+		{ip: "::ffff:172.16.5.5", asn: 64515, org: "Mapped", country: "FR"},
+		{ip: "192.168.0.1"},
+		{ip: "not an ip"},
+	}
+	for _, tc := range testCases {
+		s.Run(tc.ip, func() {
+			network, ok := db.Lookup(tc.ip)
+			if tc.asn == 0 {
+				s.False(ok)
+				return
+			}
+			s.True(ok)
+			s.Equal(tc.asn, network.ASN)
+			s.Equal(tc.org, network.Org)
+			s.Equal(tc.country, network.Country)
+		})
+	}
+
+	for _, bad := range []string{"10.0.0.0,1,a,b\n", "10.0.0.0/8,ASX,a,b\n", "10.0.0.0/8,1,a\n", "::ffff:0:0/95,1,a,b\n"} {
+		_, err := LoadGeoCSV(strings.NewReader(bad))
+		s.Error(err, bad)
+	}
+}
+
+func (s *EnrichmentSuite) TestInterceptor() {
+	path := filepath.Join(s.T().TempDir(), "geo.csv")
+	s.writeDB(path, testGeoCSV)
+	enricher, err := NewEnricher(path, nil)
+	s.Require().NoError(err)
+
+	mock := &storageMock{data: map[uint64]database.Scan{}}
+	receiver, err := New(mock, WithInterceptors(enricher.Interceptor()))
+	s.Require().NoError(err)
+
+	scn := mustScanResult(time.Now().Unix(), scanning.V2Data{ResponseStr: "hello"}, scanning.V2)
+	_, err = receiver.Process(context.TODO(), scn)
+	s.NoError(err)
+	s.Equal(map[string]string{
+		FieldASN:     "64513",
+		FieldOrg:     "Branch Office, Inc.",
+		FieldCountry: "DE",
+	}, database.FieldsOf(mock.data[database.Hash(scn)]))
+	s.EqualValues(1, enricher.Enriched())
+
+	// unknown networks are stored without enrichment
+	unknown, err := NewScanResult("192.168.0.1", 80, "HTTP", time.Now().Unix(), raw(scanning.V2Data{ResponseStr: "hello"}), scanning.V2)
+	s.Require().NoError(err)
+	_, err = receiver.Process(context.TODO(), unknown)
+	s.NoError(err)
+	s.Nil(database.FieldsOf(mock.data[database.Hash(unknown)]))
+}
+
+func (s *EnrichmentSuite) TestReload() {
+	path := filepath.Join(s.T().TempDir(), "geo.csv")
+	s.writeDB(path, testGeoCSV)
+	enricher, err := NewEnricher(path, nil)
+	s.Require().NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go enricher.Watch(ctx, 10*time.Millisecond)
+
+	// a broken file keeps the previous database in use
+	s.writeDB(path, "garbage")
+	s.NoError(os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	time.Sleep(50 * time.Millisecond)
+	network, ok := enricher.Lookup("10.1.2.3")
+	s.True(ok)
+	s.EqualValues(64512, network.ASN)
+
+	s.writeDB(path, "10.0.0.0/8,64999,New Owner,FR\n")
+	s.NoError(os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second)))
+	s.Eventually(func() bool {
+		network, ok := enricher.Lookup("10.1.2.3")
+		return ok && network.ASN == 64999
+	}, time.Second, 10*time.Millisecond)
+	_, ok = enricher.Lookup("10.10.10.10")
+	s.True(ok)
+
+	_, err = NewEnricher(filepath.Join(s.T().TempDir(), "missing.csv"), nil)
+	s.Error(err)
+}
@@ -0,0 +1,343 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// Fingerprint fields stored with the record, vendor, product, version and CPE are the ones of the first matching rule
+const (
+	FieldVendor  = "fingerprint.vendor"
+	FieldProduct = "fingerprint.product"
+	FieldVersion = "fingerprint.version"
+	FieldCPE     = "fingerprint.cpe"
+	// FieldFingerprints - names of all the matching rules, comma-separated in the order of rules
+	FieldFingerprints = "fingerprint.rules"
+)
+
+// fingerprintPrefix - prefix of every fingerprint field
+const fingerprintPrefix = "fingerprint."
+
+// versionGroup - capture group which is the version of the product, unless the rule has a version template
+const versionGroup = "version"
+
+// FingerprintRule - recognizes a product by its banner or headers,
+// Vendor, Product, Version and CPE are templates expanded with the capture groups of the match ($1, ${name}),
+// Version defaults to the group named "version", CPE to the CPE 2.3 name of the application made of the rest
+type FingerprintRule struct {
+	Name string `json:"name"`
+	// Service - only scans of the service are matched (case-insensitive), empty matches every service
+	Service string `json:"service,omitempty"`
+	// Field - parsed field the pattern is matched against, e.g. header.server, the whole response if empty
+	Field   string `json:"field,omitempty"`
+	Pattern string `json:"pattern"`
+	Vendor  string `json:"vendor,omitempty"`
+	Product string `json:"product"`
+	Version string `json:"version,omitempty"`
+	CPE     string `json:"cpe,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Fingerprint - product recognized by a rule
+type Fingerprint struct {
+	Rule    string
+	Vendor  string
+	Product string
+	Version string
+	CPE     string
+}
+
+// FingerprintRules - immutable compiled rule set
+type FingerprintRules struct {
+	rules []*FingerprintRule
+}
+
+// NewFingerprintRules - compiles the rules, rule names must be unique
+func NewFingerprintRules(rules ...FingerprintRule) (*FingerprintRules, error) {
+	fr := &FingerprintRules{}
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Name == "" || strings.Contains(rule.Name, ",") {
+			return nil, fmt.Errorf("invalid fingerprint rule name %q", rule.Name)
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("fingerprint rule %q is defined twice", rule.Name)
+		}
+		seen[rule.Name] = true
+		if rule.Product == "" {
+			return nil, fmt.Errorf("fingerprint rule %q has no product", rule.Name)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fingerprint rule %q: %w", rule.Name, err)
+		}
+		rule.re = re
+		if rule.Version == "" && re.SubexpIndex(versionGroup) > 0 {
+			rule.Version = "${" + versionGroup + "}"
+		}
+		fr.rules = append(fr.rules, &rule)
+	}
+	return fr, nil
+}
+
+// LoadFingerprintRules - reads the rules from a JSON array of FingerprintRule, e.g.
+// [{"name": "nginx", "service": "HTTP", "field": "header.server", "pattern": "^nginx/(?P<version>[0-9.]+)", "vendor": "f5", "product": "nginx"}]
+func LoadFingerprintRules(r io.Reader) (*FingerprintRules, error) {
+	var rules []FingerprintRule
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return nil, err
+	}
+	return NewFingerprintRules(rules...)
+}
+
+// Len - number of rules
+func (fr *FingerprintRules) Len() int {
+	return len(fr.rules)
+}
+
+// Match - products recognized in the scan response and fields, at most one per rule in the order of rules
+func (fr *FingerprintRules) Match(service string, response []byte, fields map[string]string) []Fingerprint {
+	var res []Fingerprint
+	for _, rule := range fr.rules {
+		if rule.Service != "" && !strings.EqualFold(rule.Service, service) {
+			continue
+		}
+		subject := response
+		if rule.Field != "" {
+			value, ok := fields[rule.Field]
+			if !ok {
+				continue
+			}
+			subject = []byte(value)
+		}
+		if m := rule.re.FindSubmatchIndex(subject); m != nil {
+			res = append(res, rule.fingerprint(subject, m))
+		}
+	}
+	return res
+}
+
+// Refingerprint - fields of the stored record with the fingerprint fields replaced by the ones the rules produce now,
+// and true if they differ from the stored fields
+func (fr *FingerprintRules) Refingerprint(row *database.ScanData) (map[string]string, bool) {
+	fields := maps.Clone(row.Fields)
+	maps.DeleteFunc(fields, func(k, _ string) bool { return strings.HasPrefix(k, fingerprintPrefix) })
+	if fps := fr.Match(row.Service, row.Raw(), fields); len(fps) > 0 {
+		if fields == nil {
+			fields = map[string]string{}
+		}
+		maps.Copy(fields, fingerprintFields(fps))
+	}
+	if len(fields) == 0 {
+		fields = nil
+	}
+	return fields, !maps.Equal(fields, row.Fields)
+}
+
+// fingerprint - the product of the match, subject is what the pattern was matched against
+func (rule *FingerprintRule) fingerprint(subject []byte, match []int) Fingerprint {
+	expand := func(template string) string {
+		if template == "" {
+			return ""
+		}
+		value := rule.re.Expand(nil, []byte(template), subject, match)
+		return strings.TrimSpace(strings.ToValidUTF8(string(value), ""))
+	}
+	fp := Fingerprint{
+		Rule:    rule.Name,
+		Vendor:  expand(rule.Vendor),
+		Product: expand(rule.Product),
+		Version: expand(rule.Version),
+		CPE:     expand(rule.CPE),
+	}
+	if fp.CPE == "" && fp.Vendor != "" && fp.Product != "" {
+		fp.CPE = cpeName(fp.Vendor, fp.Product, fp.Version)
+	}
+	return fp
+}
+
+// fingerprintFields - fields of the fingerprints, see FieldVendor and the others
+func fingerprintFields(fps []Fingerprint) map[string]string {
+	fields := map[string]string{}
+	names := make([]string, 0, len(fps))
+	for _, fp := range fps {
+		names = append(names, fp.Rule)
+	}
+	fields[FieldFingerprints] = strings.Join(names, ",")
+	for k, v := range map[string]string{
+		FieldVendor:  fps[0].Vendor,
+		FieldProduct: fps[0].Product,
+		FieldVersion: fps[0].Version,
+		FieldCPE:     fps[0].CPE,
+	} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// cpeName - CPE 2.3 formatted string of the application, unknown version is a wildcard
+func cpeName(vendor, product, version string) string {
+	return "cpe:2.3:a:" + cpeComponent(vendor) + ":" + cpeComponent(product) + ":" + cpeComponent(version) + ":*:*:*:*:*:*:*"
+}
+
+// cpeComponent - lowercase value with spaces replaced by underscores and the rest of the special characters escaped
+func cpeComponent(s string) string {
+	if s == "" {
+		return "*"
+	}
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r == ' ':
+			b.WriteByte('_')
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Fingerprinter - annotates scans with the vendor, product and version of the service (see Interceptor),
+// the rule file can be replaced at any time, it's picked up by Reload or Watch
+type Fingerprinter struct {
+	rules         *watchedFile[FingerprintRules]
+	fingerprinted atomic.Uint64
+}
+
+// NewFingerprinter - Fingerprinter constructor, loads the JSON rule file (see LoadFingerprintRules)
+func NewFingerprinter(path string, log database.Logger) (*Fingerprinter, error) {
+	rules, err := watchFile(path, "fingerprint rules", LoadFingerprintRules, func(fr *FingerprintRules) string {
+		return fmt.Sprintf("%d rules", fr.Len())
+	}, log)
+	if err != nil {
+		return nil, err
+	}
+	return &Fingerprinter{rules: rules}, nil
+}
+
+// Reload - re-reads the rule file, the current rules stay in use if the file cannot be loaded
+func (f *Fingerprinter) Reload() error {
+	return f.rules.Reload()
+}
+
+// Watch - reloads the rules whenever their file is modified, checks every interval until ctx is done
+func (f *Fingerprinter) Watch(ctx context.Context, interval time.Duration) {
+	f.rules.Watch(ctx, interval)
+}
+
+// Rules - the current rules
+func (f *Fingerprinter) Rules() *FingerprintRules {
+	return f.rules.Load()
+}
+
+// Fingerprinted - number of scans recognized so far
+func (f *Fingerprinter) Fingerprinted() uint64 {
+	return f.fingerprinted.Load()
+}
+
+// Interceptor - annotates scans with the fingerprint fields, unrecognized scans are passed as they are
+func (f *Fingerprinter) Interceptor() Interceptor {
+	return func(ctx context.Context, scn *ScanResult, next Handler) (database.Result, error) {
+		fps := f.Rules().Match(scn.Service(), scn.Response(), scn.Fields())
+		if len(fps) == 0 {
+			return next(ctx, scn)
+		}
+		f.fingerprinted.Add(1)
+		for k, v := range fingerprintFields(fps) {
+			scn = scn.Annotate(k, v)
+		}
+		return next(ctx, scn)
+	}
+}
+
+// RecordStorage - storage whose records can be walked through and have their fields replaced
+type RecordStorage interface {
+	ListRecords(ctx context.Context, service string, after uint64, limit int) ([]*database.ScanData, error)
+	SetFields(ctx context.Context, row *database.ScanData, fields map[string]string) (bool, error)
+}
+
+// DefaultRefingerprintBatch - default number of records read at once by Refingerprint
+const DefaultRefingerprintBatch = 500
+
+// RefingerprintConfig - Refingerprint configuration
+type RefingerprintConfig struct {
+	// Service - only records of the service are re-fingerprinted, every record if empty
+	Service string
+	// BatchSize - number of records read at once, DefaultRefingerprintBatch if not set
+	BatchSize int
+	// DryRun - only count the records which would be updated
+	DryRun bool
+}
+
+// RefingerprintStats - Refingerprint summary
+type RefingerprintStats struct {
+	// Read - records read from the storage
+	Read int
+	// Fingerprinted - records recognized by at least one rule
+	Fingerprinted int
+	// Updated - records whose fingerprint fields were replaced (would be replaced in a dry run)
+	Updated int
+	// Skipped - records which were rewritten by fresher scans while being re-fingerprinted, they carry fresh fingerprints anyway
+	Skipped int
+}
+
+// Refingerprint - applies the rules to the stored records, e.g. after the rules have been changed,
+// and replaces the fingerprint fields of the records they produce different fields for
+func Refingerprint(ctx context.Context, storage RecordStorage, rules *FingerprintRules, cfg RefingerprintConfig) (RefingerprintStats, error) {
+	var stats RefingerprintStats
+	batch := cfg.BatchSize
+	if batch <= 0 {
+		batch = DefaultRefingerprintBatch
+	}
+	var after uint64
+	for {
+		rows, err := storage.ListRecords(ctx, cfg.Service, after, batch)
+		if err != nil {
+			return stats, err
+		}
+		for _, row := range rows {
+			stats.Read++
+			after = row.Hash
+			fields, changed := rules.Refingerprint(row)
+			if _, ok := fields[FieldFingerprints]; ok {
+				stats.Fingerprinted++
+			}
+			if !changed {
+				continue
+			}
+			if cfg.DryRun {
+				stats.Updated++
+				continue
+			}
+			updated, err := storage.SetFields(ctx, row, fields)
+			if err != nil {
+				return stats, fmt.Errorf("cannot update fields of record %d: %w", row.Hash, err)
+			}
+			if updated {
+				stats.Updated++
+			} else {
+				stats.Skipped++
+			}
+		}
+		if len(rows) < batch {
+			return stats, nil
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package processing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/memory"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
+const testFingerprintRules = `[
+	{"name": "nginx", "service": "HTTP", "field": "header.server", "pattern": "^nginx(?:/(?P<version>[0-9.]+))?", "vendor": "F5", "product": "nginx"},
+	{"name": "php", "service": "HTTP", "field": "header.x-powered-by", "pattern": "^PHP/([0-9.]+)", "vendor": "PHP", "product": "PHP", "version": "$1"},
+	{"name": "openssh", "service": "ssh", "pattern": "^SSH-[0-9.]+-OpenSSH_([0-9.]+)(p[0-9]+)?", "vendor": "OpenBSD", "product": "OpenSSH",
+		"version": "$1$2", "cpe": "cpe:2.3:a:openbsd:openssh:$1:$2:*:*:*:*:*:*"},
+	{"name": "any-apache", "pattern": "Apache Server at", "product": "Apache HTTP Server"}
+]`
+
+type FingerprintSuite struct {
+	suite.Suite
+}
+
+func TestFingerprintSuite(t *testing.T) {
+	suite.Run(t, &FingerprintSuite{})
+}
+
+func (s *FingerprintSuite) writeRules(path, content string) {
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+}
+
+func (s *FingerprintSuite) TestMatch() {
+	rules, err := LoadFingerprintRules(strings.NewReader(testFingerprintRules))
+	s.Require().NoError(err)
+	s.Equal(4, rules.Len())
+
+	testCases := []struct {
+		title    string
+		service  string
+		response string
+		fields   map[string]string
+		expected []Fingerprint
+	}{
+		{
+			title:   "header with version",
+			service: "HTTP",
+			fields:  map[string]string{"header.server": "nginx/1.25.3", "header.x-powered-by": "PHP/8.2.1"},
+			expected: []Fingerprint{
+				{Rule: "nginx", Vendor: "F5", Product: "nginx", Version: "1.25.3", CPE: "cpe:2.3:a:f5:nginx:1.25.3:*:*:*:*:*:*:*"},
+				{Rule: "php", Vendor: "PHP", Product: "PHP", Version: "8.2.1", CPE: "cpe:2.3:a:php:php:8.2.1:*:*:*:*:*:*:*"},
+			},
+		},
+		{
+			title:    "header without version",
+			service:  "HTTP",
+			fields:   map[string]string{"header.server": "nginx"},
+			expected: []Fingerprint{{Rule: "nginx", Vendor: "F5", Product: "nginx", CPE: "cpe:2.3:a:f5:nginx:*:*:*:*:*:*:*:*"}},
+		},
+		{
+			title:    "banner with CPE template",
+			service:  "SSH",
+			response: "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13",
+			expected: []Fingerprint{{Rule: "openssh", Vendor: "OpenBSD", Product: "OpenSSH", Version: "9.6p1", CPE: "cpe:2.3:a:openbsd:openssh:9.6:p1:*:*:*:*:*:*"}},
+		},
+		{
+			title:    "rule of another service",
+			service:  "HTTP",
+			response: "SSH-2.0-OpenSSH_9.6p1",
+		},
+		{
+			title:    "rule of any service without vendor",
+			service:  "HTTPS",
+			response: "<address>Apache Server at example.com</address>",
+			expected: []Fingerprint{{Rule: "any-apache", Product: "Apache HTTP Server"}},
+		},
+	}
+	for _, tc := range testCases {
+		s.Run(tc.title, func() {
+			s.Equal(tc.expected, rules.Match(tc.service, []byte(tc.response), tc.fields))
+		})
+	}
+
+	s.Equal(`cpe:2.3:a:apache_software_foundation:http\:server:2.4:*:*:*:*:*:*:*`, cpeName("Apache Software Foundation", "HTTP:Server", "2.4"))
+
+	for _, bad := range []string{
+		`{"name": "not an array"}`,
+		`[{"name": "x", "pattern": "(", "product": "x"}]`,
+		`[{"name": "x", "pattern": "x"}]`,
+		`[{"name": "a,b", "pattern": "x", "product": "x"}]`,
+		`[{"name": "x", "pattern": "x", "product": "x"}, {"name": "x", "pattern": "y", "product": "y"}]`,
+		`[{"name": "x", "pattern": "x", "product": "x", "typo": "x"}]`,
+	} {
+		_, err := LoadFingerprintRules(strings.NewReader(bad))
+		s.Error(err, bad)
+	}
+}
+
+func (s *FingerprintSuite) TestInterceptor() {
+	path := filepath.Join(s.T().TempDir(), "fingerprints.json")
+	s.writeRules(path, testFingerprintRules)
+	fingerprinter, err := NewFingerprinter(path, nil)
+	s.Require().NoError(err)
+
+	storage := memory.New()
+	receiver, err := New(storage, WithInterceptors(fingerprinter.Interceptor()))
+	s.Require().NoError(err)
+
+	scn, err := NewScanResult("10.0.0.1", 80, "HTTP", time.Now().Unix(),
+		raw(scanning.V2Data{ResponseStr: "HTTP/1.1 200 OK\r\nServer: nginx/1.25.3\r\nX-Powered-By: PHP/8.2.1\r\n\r\n"}), scanning.V2)
+	s.Require().NoError(err)
+	_, err = receiver.Process(context.TODO(), scn)
+	s.NoError(err)
+	rows, err := storage.FindByField(context.TODO(), "HTTP", FieldProduct, "nginx")
+	s.NoError(err)
+	s.Require().Len(rows, 1)
+	s.Equal("1.25.3", rows[0].Fields[FieldVersion])
+	s.Equal("cpe:2.3:a:f5:nginx:1.25.3:*:*:*:*:*:*:*", rows[0].Fields[FieldCPE])
+	s.Equal("nginx,php", rows[0].Fields[FieldFingerprints])
+	s.Equal("200", rows[0].Fields["status_code"])
+	s.EqualValues(1, fingerprinter.Fingerprinted())
+
+	// unrecognized services are stored without fingerprints
+	unknown := mustScanResult(time.Now().Unix(), scanning.V2Data{ResponseStr: "hello"}, scanning.V2)
+	_, err = receiver.Process(context.TODO(), unknown)
+	s.NoError(err)
+	all, err := storage.GetAll(context.TODO())
+	s.NoError(err)
+	s.NotContains(all[database.Hash(unknown)].Fields, FieldFingerprints)
+	s.EqualValues(1, fingerprinter.Fingerprinted())
+}
+
+func (s *FingerprintSuite) TestReload() {
+	path := filepath.Join(s.T().TempDir(), "fingerprints.json")
+	s.writeRules(path, testFingerprintRules)
+	fingerprinter, err := NewFingerprinter(path, nil)
+	s.Require().NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go fingerprinter.Watch(ctx, 10*time.Millisecond)
+
+	// broken rules keep the previous ones in use
+	s.writeRules(path, `[{"name": "broken", "pattern": "(", "product": "x"}]`)
+	s.NoError(os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	time.Sleep(50 * time.Millisecond)
+	s.Equal(4, fingerprinter.Rules().Len())
+
+	s.writeRules(path, `[{"name": "caddy", "field": "header.server", "pattern": "^Caddy$", "vendor": "Caddy", "product": "Caddy"}]`)
+	s.NoError(os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second)))
+	s.Eventually(func() bool {
+		return fingerprinter.Rules().Len() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = NewFingerprinter(filepath.Join(s.T().TempDir(), "missing.json"), nil)
+	s.Error(err)
+}
+
+func (s *FingerprintSuite) TestRefingerprint() {
+	storage := memory.New()
+	now := time.Now().Unix()
+	for i, server := range []string{"nginx/1.24.0", "nginx/1.25.3", "Caddy", "Caddy"} {
+		_, err := storage.Put(context.TODO(), (&database.ScanData{
+			IP: "10.0.0." + strconv.Itoa(i+1), Port: 80, Service: "HTTP", Timestamp: now,
+			Data:   "HTTP/1.1 200 OK\r\nServer: " + server + "\r\n\r\n",
+			Fields: map[string]string{"header.server": server},
+		}).AsScan())
+		s.Require().NoError(err)
+	}
+	old, err := NewFingerprintRules(FingerprintRule{Name: "nginx", Field: "header.server", Pattern: "^nginx/(?P<version>[0-9.]+)", Vendor: "F5", Product: "nginx"})
+	s.Require().NoError(err)
+	stats, err := Refingerprint(context.TODO(), storage, old, RefingerprintConfig{BatchSize: 3})
+	s.NoError(err)
+	s.Equal(RefingerprintStats{Read: 4, Fingerprinted: 2, Updated: 2}, stats)
+
+	// new rules: nginx versions are dropped, Caddy is recognized
+	rules, err := NewFingerprintRules(
+		FingerprintRule{Name: "nginx", Field: "header.server", Pattern: "^nginx", Vendor: "F5", Product: "nginx"},
+		FingerprintRule{Name: "caddy", Field: "header.server", Pattern: "^Caddy$", Vendor: "Caddy", Product: "Caddy"},
+	)
+	s.Require().NoError(err)
+	stats, err = Refingerprint(context.TODO(), storage, rules, RefingerprintConfig{DryRun: true})
+	s.NoError(err)
+	s.Equal(RefingerprintStats{Read: 4, Fingerprinted: 4, Updated: 4}, stats)
+	caddies, err := storage.FindByField(context.TODO(), "HTTP", FieldProduct, "Caddy")
+	s.NoError(err)
+	s.Empty(caddies)
+
+	stats, err = Refingerprint(context.TODO(), storage, rules, RefingerprintConfig{Service: "HTTP", BatchSize: 2})
+	s.NoError(err)
+	s.Equal(RefingerprintStats{Read: 4, Fingerprinted: 4, Updated: 4}, stats)
+	caddies, err = storage.FindByField(context.TODO(), "HTTP", FieldProduct, "Caddy")
+	s.NoError(err)
+	s.Len(caddies, 2)
+	nginxes, err := storage.FindByField(context.TODO(), "HTTP", FieldProduct, "nginx")
+	s.NoError(err)
+	s.Require().Len(nginxes, 2)
+	s.NotContains(nginxes[0].Fields, FieldVersion)
+	s.Equal("nginx", nginxes[0].Fields[FieldFingerprints])
+
+	// nothing changes the second time, other services aren't touched
+	stats, err = Refingerprint(context.TODO(), storage, rules, RefingerprintConfig{})
+	s.NoError(err)
+	s.Equal(RefingerprintStats{Read: 4, Fingerprinted: 4}, stats)
+	stats, err = Refingerprint(context.TODO(), storage, rules, RefingerprintConfig{Service: "SSH"})
+	s.NoError(err)
+	s.Zero(stats)
+}
+
+func (s *FingerprintSuite) TestRefingerprintConcurrentWrite() {
+	storage := memory.New()
+	scan := &database.ScanData{IP: "10.0.0.1", Port: 80, Service: "HTTP", Timestamp: 100, Fields: map[string]string{"header.server": "nginx"}}
+	_, err := storage.Put(context.TODO(), scan.AsScan())
+	s.Require().NoError(err)
+	rows, err := storage.ListRecords(context.TODO(), "", 0, 10)
+	s.Require().NoError(err)
+	s.Require().Len(rows, 1)
+
+	// a fresher scan arrives after the record has been read
+	fresher := *scan
+	fresher.Timestamp = 200
+	_, err = storage.Put(context.TODO(), fresher.AsScan())
+	s.Require().NoError(err)
+	updated, err := storage.SetFields(context.TODO(), rows[0], map[string]string{FieldProduct: "nginx"})
+	s.NoError(err)
+	s.False(updated)
+}
@@ -0,0 +1,98 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"runtime/debug"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// ErrDropped - the scan was deliberately dropped by an interceptor, nothing was stored
+var ErrDropped = errors.New("scan dropped")
+
+// Handler - processes a scan, the last handler of the chain stores it
+type Handler func(ctx context.Context, scn *ScanResult) (database.Result, error)
+
+// Interceptor - a link of the Receiver processing chain, it may inspect the scan, pass a transformed or annotated
+// copy of it to next, drop it by returning without calling next (ErrDropped by convention), and act on the result of next
+type Interceptor func(ctx context.Context, scn *ScanResult, next Handler) (database.Result, error)
+
+// WithInterceptors - appends interceptors to the Receiver chain, the first one runs first,
+// they run after the built-in validation and clock skew checks and right before the storage
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(r *Receiver) {
+		r.interceptors = append(r.interceptors, interceptors...)
+	}
+}
+
+// chain - builds a single handler out of the interceptors and the final handler,
+// a nil scan passed down the chain by a misbehaving interceptor is rejected with *DecodeError
+func chain(interceptors []Interceptor, last Handler) Handler {
+	h := nonNil(last)
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], h
+		h = nonNil(func(ctx context.Context, scn *ScanResult) (database.Result, error) {
+			return interceptor(ctx, scn, next)
+		})
+	}
+	return h
+}
+
+func nonNil(h Handler) Handler {
+	return func(ctx context.Context, scn *ScanResult) (database.Result, error) {
+		if scn == nil {
+			return database.Result{}, &DecodeError{Kind: ErrEmptyResponse}
+		}
+		return h(ctx, scn)
+	}
+}
+
+// Filter - drops scans the predicate returns false for with ErrDropped
+func Filter(keep func(scn *ScanResult) bool) Interceptor {
+	return func(ctx context.Context, scn *ScanResult, next Handler) (database.Result, error) {
+		if !keep(scn) {
+			return database.Result{}, ErrDropped
+		}
+		return next(ctx, scn)
+	}
+}
+
+// Annotate - stores the value returned by fn as the key field of the scan, nothing is added if fn returns false
+func Annotate(key string, fn func(scn *ScanResult) (string, bool)) Interceptor {
+	return func(ctx context.Context, scn *ScanResult, next Handler) (database.Result, error) {
+		if value, ok := fn(scn); ok {
+			scn = scn.Annotate(key, value)
+		}
+		return next(ctx, scn)
+	}
+}
+
+// Recover - turns panics of the rest of the chain into errors, so a buggy interceptor doesn't take the processor down,
+// the stack of the panic is logged once where it's recovered, the error only carries the panic value
+func Recover(log database.Logger) Interceptor {
+	log = database.NewNullSafeLogger(log)
+	return func(ctx context.Context, scn *ScanResult, next Handler) (res database.Result, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("panic while processing scan [Service: %s, IP: %s, Port: %d]: %v", scn.Service(), scn.IP(), scn.Port(), p)
+				log.Error(fmt.Sprintf("%s\n%s", err, debug.Stack()))
+				res = database.Result{}
+			}
+		}()
+		return next(ctx, scn)
+	}
+}
+
+// Annotate - copy of the scan result with an extra field, stored along with the fields parsed from the response
+func (s *ScanResult) Annotate(key, value string) *ScanResult {
+	res := *s
+	res.fields = maps.Clone(s.fields)
+	if res.fields == nil {
+		res.fields = map[string]string{}
+	}
+	res.fields[key] = value
+	return &res
+}
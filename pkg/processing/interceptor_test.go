@@ -0,0 +1,131 @@
+package processing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
+type InterceptorSuite struct {
+	suite.Suite
+}
+
+func TestInterceptorSuite(t *testing.T) {
+	suite.Run(t, &InterceptorSuite{})
+}
+
+func (s *InterceptorSuite) TestOrder() {
+	var trace []string
+	tracing := func(name string) Interceptor {
+		return func(ctx context.Context, scn *ScanResult, next Handler) (database.Result, error) {
+			trace = append(trace, name+" before")
+			res, err := next(ctx, scn)
+			trace = append(trace, name+" after "+res.String())
+			return res, err
+		}
+	}
+	mock := &storageMock{data: map[uint64]database.Scan{}}
+	receiver, err := New(mock, WithInterceptors(tracing("first"), tracing("second")), WithInterceptors(tracing("third")))
+	s.NoError(err)
+
+	res, err := receiver.Process(context.TODO(), mustScanResult(time.Now().Unix(), scanning.V2Data{ResponseStr: "hello"}, scanning.V2))
+	s.NoError(err)
+	s.Equal(database.Result{Outcome: database.Inserted}, res)
+	s.Equal([]string{"first before", "second before", "third before", "third after inserted", "second after inserted", "first after inserted"}, trace)
+}
+
+func (s *InterceptorSuite) TestBuiltinChecksComeFirst() {
+	called := false
+	spy := func(ctx context.Context, scn *ScanResult, next Handler) (database.Result, error) {
+		called = true
+		return next(ctx, scn)
+	}
+	mock := &storageMock{data: map[uint64]database.Scan{}}
+	// options order doesn't matter - validation always runs before custom interceptors
+	receiver, err := New(mock, WithInterceptors(spy), WithValidator(NewValidator(DefaultValidationConfig())))
+	s.NoError(err)
+
+	scn, err := NewScanResult("not an ip", 80, "HTTP", time.Now().Unix(), raw(scanning.V2Data{ResponseStr: "hello"}), scanning.V2)
+	s.NoError(err)
+	_, err = receiver.Process(context.TODO(), scn)
+	s.ErrorIs(err, ErrInvalidScan)
+	s.False(called)
+	s.Empty(mock.data)
+}
+
+func (s *InterceptorSuite) TestTransform() {
+	mock := &storageMock{data: map[uint64]database.Scan{}}
+	receiver, err := New(mock, WithInterceptors(func(ctx context.Context, scn *ScanResult, next Handler) (database.Result, error) {
+		return next(ctx, scn.withTimestamp(42))
+	}))
+	s.NoError(err)
+
+	scn := mustScanResult(time.Now().Unix(), scanning.V2Data{ResponseStr: "hello"}, scanning.V2)
+	_, err = receiver.Process(context.TODO(), scn)
+	s.NoError(err)
+	s.EqualValues(42, mock.data[database.Hash(scn)].Timestamp())
+	s.NotEqual(int64(42), scn.Timestamp(), "the original scan must stay intact")
+}
+
+func (s *InterceptorSuite) TestFilter() {
+	mock := &storageMock{data: map[uint64]database.Scan{}}
+	receiver, err := New(mock, WithInterceptors(Filter(func(scn *ScanResult) bool {
+		return scn.Service() != "AWESOME"
+	})))
+	s.NoError(err)
+
+	res, err := receiver.Process(context.TODO(), mustScanResult(time.Now().Unix(), scanning.V2Data{ResponseStr: "hello"}, scanning.V2))
+	s.ErrorIs(err, ErrDropped)
+	s.Equal(database.Rejection(string(ReasonDropped)), res)
+	s.Equal("rejected: dropped", res.String())
+	s.Empty(mock.data)
+}
+
+func (s *InterceptorSuite) TestAnnotate() {
+	mock := &storageMock{data: map[uint64]database.Scan{}}
+	receiver, err := New(mock, WithInterceptors(
+		Annotate("source", func(*ScanResult) (string, bool) { return "scanner-1", true }),
+		Annotate("skipped", func(*ScanResult) (string, bool) { return "", false }),
+	))
+	s.NoError(err)
+
+	scn := mustScanResult(time.Now().Unix(), scanning.V2Data{ResponseStr: "hello"}, scanning.V2)
+	_, err = receiver.Process(context.TODO(), scn)
+	s.NoError(err)
+	s.Equal(map[string]string{"source": "scanner-1"}, database.FieldsOf(mock.data[database.Hash(scn)]))
+	s.Nil(scn.Fields(), "the original scan must stay intact")
+}
+
+func (s *InterceptorSuite) TestRecover() {
+	mock := &storageMock{data: map[uint64]database.Scan{}}
+	log := &logRecorder{}
+	receiver, err := New(mock, WithInterceptors(Recover(log), func(context.Context, *ScanResult, Handler) (database.Result, error) {
+		panic("buggy interceptor")
+	}))
+	s.NoError(err)
+
+	res, err := receiver.Process(context.TODO(), mustScanResult(time.Now().Unix(), scanning.V2Data{ResponseStr: "hello"}, scanning.V2))
+	s.ErrorContains(err, "buggy interceptor")
+	s.NotContains(err.Error(), "goroutine", "the stack is logged, not returned")
+	s.Equal(database.Unknown, res.Outcome)
+	s.Require().Len(log.errors, 1)
+	s.Contains(log.errors[0], "buggy interceptor")
+	s.Contains(log.errors[0], "goroutine")
+}
+
+func (s *InterceptorSuite) TestNilScan() {
+	mock := &storageMock{data: map[uint64]database.Scan{}}
+	receiver, err := New(mock, WithInterceptors(func(ctx context.Context, _ *ScanResult, next Handler) (database.Result, error) {
+		return next(ctx, nil)
+	}))
+	s.NoError(err)
+
+	_, err = receiver.Process(context.TODO(), mustScanResult(time.Now().Unix(), scanning.V2Data{ResponseStr: "hello"}, scanning.V2))
+	s.ErrorIs(err, ErrEmptyResponse)
+	s.Empty(mock.data)
+}
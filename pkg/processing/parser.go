@@ -0,0 +1,87 @@
+package processing
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Parser - extracts structured fields from the service response of a single protocol,
+// responses of another shape should fail with an error rather than produce partial garbage
+type Parser interface {
+	Parse(response []byte) (map[string]string, error)
+}
+
+// ParserFunc - adapter to use ordinary functions as Parser
+type ParserFunc func(response []byte) (map[string]string, error)
+
+// Parse - calls f(response)
+func (f ParserFunc) Parse(response []byte) (map[string]string, error) {
+	return f(response)
+}
+
+// ParserRegistry - parsers keyed by service name, service names are case-insensitive
+type ParserRegistry struct {
+	mtx     sync.RWMutex
+	parsers map[string]Parser
+}
+
+// NewParserRegistry - ParserRegistry constructor, the registry is empty
+func NewParserRegistry() *ParserRegistry {
+	return &ParserRegistry{parsers: map[string]Parser{}}
+}
+
+// DefaultParsers - registry used by ScanResult, comes with HTTP, SSH and DNS parsers
+var DefaultParsers = NewParserRegistry()
+
+func init() {
+	MustRegisterParser("HTTP", ParserFunc(parseHTTP))
+	MustRegisterParser("SSH", ParserFunc(parseSSH))
+	MustRegisterParser("DNS", ParserFunc(parseDNS))
+}
+
+// Register - registers the parser of a service, services cannot be registered twice
+func (r *ParserRegistry) Register(service string, p Parser) error {
+	if p == nil {
+		return fmt.Errorf("cannot register nil parser for service %q", service)
+	}
+	key := strings.ToUpper(service)
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.parsers[key]; ok {
+		return fmt.Errorf("parser for service %q is already registered", service)
+	}
+	r.parsers[key] = p
+	return nil
+}
+
+// Parse - parses the response with the parser of the service,
+// returns nil fields if there is no parser for the service or the response couldn't be parsed
+func (r *ParserRegistry) Parse(service string, response []byte) (map[string]string, error) {
+	r.mtx.RLock()
+	p, ok := r.parsers[strings.ToUpper(service)]
+	r.mtx.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	fields, err := p.Parse(response)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s response: %w", service, err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// RegisterParser - registers the parser of a service in DefaultParsers
+func RegisterParser(service string, p Parser) error {
+	return DefaultParsers.Register(service, p)
+}
+
+// MustRegisterParser - like RegisterParser, but panics on error, meant for init functions
+func MustRegisterParser(service string, p Parser) {
+	if err := RegisterParser(service, p); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,161 @@
+package processing_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/netip"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/igorvan/scan-takehome/pkg/processing"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
+type ParserSuite struct {
+	suite.Suite
+}
+
+func TestParserSuite(t *testing.T) {
+	suite.Run(t, &ParserSuite{})
+}
+
+func (s *ParserSuite) TestHTTP() {
+	fields, err := processing.DefaultParsers.Parse("HTTP", []byte("HTTP/1.1 301 Moved Permanently\r\n"+
+		"Server: nginx/1.24.0\r\n"+
+		"Content-Type: text/html\r\n"+
+		"Set-Cookie: a=1\r\n"+
+		"Set-Cookie: b=2\r\n"+
+		"\r\n"+
+		"<html><head><TITLE>\n  Moved &amp; gone\n</TITLE></head>"))
+	s.NoError(err)
+	s.Equal(map[string]string{
+		"version":             "1.1",
+		"status_code":         "301",
+		"reason":              "Moved Permanently",
+		"header.server":       "nginx/1.24.0",
+		"header.content-type": "text/html",
+		"header.set-cookie":   "a=1, b=2",
+		"title":               "Moved & gone",
+	}, fields)
+
+	// truncated right after the status line
+	fields, err = processing.DefaultParsers.Parse("http", []byte("HTTP/1.0 200 OK\r\n"))
+	s.NoError(err)
+	s.Equal(map[string]string{"version": "1.0", "status_code": "200", "reason": "OK"}, fields)
+
+	// long titles are cut without splitting multibyte characters
+	fields, err = processing.DefaultParsers.Parse("HTTP", []byte("HTTP/1.1 200 OK\r\n\r\n<title>"+
+		strings.Repeat("é", 200)+"</title>"))
+	s.NoError(err)
+	s.Equal(strings.Repeat("é", 127), fields["title"])
+	s.True(utf8.ValidString(fields["title"]))
+
+	for _, bad := range []string{"service response: 42", "HTTP/1.1 OK", "HTTP/1.1 2000 OK", ""} {
+		fields, err = processing.DefaultParsers.Parse("HTTP", []byte(bad))
+		s.Error(err, bad)
+		s.Nil(fields)
+	}
+}
+
+func (s *ParserSuite) TestSSH() {
+	fields, err := processing.DefaultParsers.Parse("SSH", []byte("SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6\r\n"))
+	s.NoError(err)
+	s.Equal(map[string]string{"proto_version": "2.0", "software": "OpenSSH_8.9p1", "comments": "Ubuntu-3ubuntu0.6"}, fields)
+
+	// other lines may precede the identification string
+	fields, err = processing.DefaultParsers.Parse("SSH", []byte("Welcome!\r\nSSH-1.99-dropbear_2022.83\r\n\x00\x00\x01"))
+	s.NoError(err)
+	s.Equal(map[string]string{"proto_version": "1.99", "software": "dropbear_2022.83"}, fields)
+
+	for _, bad := range []string{"service response: 42", "SSH-2.0", "SSH--x"} {
+		fields, err = processing.DefaultParsers.Parse("SSH", []byte(bad))
+		s.Error(err, bad)
+		s.Nil(fields)
+	}
+}
+
+func (s *ParserSuite) TestDNS() {
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 4242, Response: true, Authoritative: true, RCode: dnsmessage.RCodeSuccess},
+		Questions: []dnsmessage.Question{
+			{Name: dnsmessage.MustNewName("example.com."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+		},
+		Answers: []dnsmessage.Resource{
+			{
+				Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("example.com."), Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("www.example.com.")},
+			},
+			{
+				Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("www.example.com."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+				Body:   &dnsmessage.AResource{A: netip.MustParseAddr("93.184.215.14").As4()},
+			},
+		},
+	}
+	packed, err := msg.Pack()
+	s.Require().NoError(err)
+	expected := map[string]string{
+		"id":            "4242",
+		"rcode":         "Success",
+		"authoritative": "true",
+		"recursion":     "false",
+		"answer_count":  "2",
+		"question":      "example.com.",
+		"question_type": "A",
+		"answers":       "www.example.com.,93.184.215.14",
+	}
+
+	fields, err := processing.DefaultParsers.Parse("DNS", packed)
+	s.NoError(err)
+	s.Equal(expected, fields)
+
+	// DNS over TCP
+	tcp := binary.BigEndian.AppendUint16(nil, uint16(len(packed)))
+	fields, err = processing.DefaultParsers.Parse("DNS", append(tcp, packed...))
+	s.NoError(err)
+	s.Equal(expected, fields)
+
+	msg.Response = false
+	query, err := msg.Pack()
+	s.Require().NoError(err)
+	for _, bad := range [][]byte{[]byte("service response: 42"), query, packed[:len(packed)-3]} {
+		fields, err = processing.DefaultParsers.Parse("DNS", bad)
+		s.Error(err)
+		s.Nil(fields)
+	}
+}
+
+func (s *ParserSuite) TestRegistry() {
+	r := processing.NewParserRegistry()
+	fields, err := r.Parse("FTP", []byte("220 ready"))
+	s.NoError(err)
+	s.Nil(fields)
+
+	ftp := processing.ParserFunc(func(response []byte) (map[string]string, error) {
+		return map[string]string{"banner": string(response)}, nil
+	})
+	s.NoError(r.Register("ftp", ftp))
+	s.Error(r.Register("FTP", ftp))
+	s.Error(r.Register("SMTP", nil))
+
+	fields, err = r.Parse("FTP", []byte("220 ready"))
+	s.NoError(err)
+	s.Equal(map[string]string{"banner": "220 ready"}, fields)
+}
+
+func (s *ParserSuite) TestScanResultFields() {
+	data, _ := json.Marshal(scanning.V2Data{ResponseStr: "SSH-2.0-OpenSSH_9.6"})
+	res, err := processing.NewScanResult("1.1.1.1", 22, "SSH", 100, data, scanning.V2)
+	s.NoError(err)
+	s.Equal(map[string]string{"proto_version": "2.0", "software": "OpenSSH_9.6"}, res.Fields())
+
+	// unparseable responses are still valid scans
+	data, _ = json.Marshal(scanning.V2Data{ResponseStr: "service response: 42"})
+	res, err = processing.NewScanResult("1.1.1.1", 22, "SSH", 100, data, scanning.V2)
+	s.NoError(err)
+	s.Nil(res.Fields())
+	s.Equal("service response: 42", res.Data())
+}
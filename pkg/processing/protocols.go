@@ -0,0 +1,166 @@
+package processing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"html"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxTitleLength - longer HTML titles are truncated
+const maxTitleLength = 255
+
+var (
+	errNotHTTP = errors.New("not an HTTP response")
+	errNotSSH  = errors.New("no SSH identification string")
+
+	titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// parseHTTP - status line, headers (as "header.<lowercase name>") and HTML title of an HTTP/1.x response,
+// truncated responses are fine, whatever was received is parsed
+func parseHTTP(response []byte) (map[string]string, error) {
+	head, body, _ := bytes.Cut(response, []byte("\r\n\r\n"))
+	lines := strings.Split(strings.ReplaceAll(string(head), "\r\n", "\n"), "\n")
+
+	// HTTP/1.1 200 OK
+	version, status, _ := strings.Cut(lines[0], " ")
+	if !strings.HasPrefix(version, "HTTP/") {
+		return nil, errNotHTTP
+	}
+	code, reason, _ := strings.Cut(status, " ")
+	if _, err := strconv.ParseUint(code, 10, 16); err != nil || len(code) != 3 {
+		return nil, fmt.Errorf("%w: bad status code %q", errNotHTTP, code)
+	}
+	fields := map[string]string{
+		"version":     strings.TrimPrefix(version, "HTTP/"),
+		"status_code": code,
+	}
+	if reason != "" {
+		fields["reason"] = reason
+	}
+
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || name == "" {
+			continue
+		}
+		key := "header." + strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if prev, ok := fields[key]; ok {
+			value = prev + ", " + value
+		}
+		fields[key] = value
+	}
+
+	if m := titlePattern.FindSubmatch(body); m != nil {
+		title := strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+		if len(title) > maxTitleLength {
+			// cut on a rune boundary, so a multibyte character is never split in half
+			cut := maxTitleLength
+			for cut > 0 && !utf8.RuneStart(title[cut]) {
+				cut--
+			}
+			title = title[:cut]
+		}
+		if title != "" {
+			fields["title"] = title
+		}
+	}
+	return fields, nil
+}
+
+// parseSSH - protocol and software versions from the SSH identification string (RFC 4253, section 4.2):
+// SSH-protoversion-softwareversion SP comments CRLF, servers may send other lines before it
+func parseSSH(response []byte) (map[string]string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(response))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if !strings.HasPrefix(line, "SSH-") {
+			continue
+		}
+		ident, comments, _ := strings.Cut(line, " ")
+		proto, software, ok := strings.Cut(strings.TrimPrefix(ident, "SSH-"), "-")
+		if !ok || proto == "" || software == "" {
+			return nil, fmt.Errorf("%w: malformed %q", errNotSSH, line)
+		}
+		fields := map[string]string{
+			"proto_version": proto,
+			"software":      software,
+		}
+		if comments != "" {
+			fields["comments"] = comments
+		}
+		return fields, nil
+	}
+	return nil, errNotSSH
+}
+
+// parseDNS - header, first question and answers of a DNS wire format message,
+// both UDP and TCP (length-prefixed) messages are accepted
+func parseDNS(response []byte) (map[string]string, error) {
+	var msg dnsmessage.Message
+	err := msg.Unpack(response)
+	if err != nil && len(response) > 2 && int(binary.BigEndian.Uint16(response)) == len(response)-2 {
+		err = msg.Unpack(response[2:])
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !msg.Response {
+		return nil, errors.New("DNS message is a query, not a response")
+	}
+
+	fields := map[string]string{
+		"id":            strconv.Itoa(int(msg.ID)),
+		"rcode":         strings.TrimPrefix(msg.RCode.String(), "RCode"),
+		"authoritative": strconv.FormatBool(msg.Authoritative),
+		"recursion":     strconv.FormatBool(msg.RecursionAvailable),
+		"answer_count":  strconv.Itoa(len(msg.Answers)),
+	}
+	if len(msg.Questions) > 0 {
+		fields["question"] = msg.Questions[0].Name.String()
+		fields["question_type"] = strings.TrimPrefix(msg.Questions[0].Type.String(), "Type")
+	}
+	answers := make([]string, 0, len(msg.Answers))
+	for _, a := range msg.Answers {
+		if v := dnsValue(a.Body); v != "" {
+			answers = append(answers, v)
+		}
+	}
+	if len(answers) > 0 {
+		fields["answers"] = strings.Join(answers, ",")
+	}
+	return fields, nil
+}
+
+// dnsValue - answer record value, empty for record types we don't care about
+func dnsValue(body dnsmessage.ResourceBody) string {
+	switch r := body.(type) {
+	case *dnsmessage.AResource:
+		return netip.AddrFrom4(r.A).String()
+	case *dnsmessage.AAAAResource:
+		return netip.AddrFrom16(r.AAAA).String()
+	case *dnsmessage.CNAMEResource:
+		return r.CNAME.String()
+	case *dnsmessage.NSResource:
+		return r.NS.String()
+	case *dnsmessage.PTRResource:
+		return r.PTR.String()
+	case *dnsmessage.MXResource:
+		return r.MX.String()
+	case *dnsmessage.TXTResource:
+		return strings.Join(r.TXT, " ")
+	default:
+		return ""
+	}
+}
@@ -2,25 +2,228 @@ package processing
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// Quarantine - storage for rejected scans, kept for later inspection
+type Quarantine interface {
+	Quarantine(ctx context.Context, scan database.Scan, reason string) error
+}
+
+// Option - Receiver configuration option
+type Option func(r *Receiver)
+
+// WithValidator - validates every scan before it is stored, invalid scans are rejected with *ValidationError
+func WithValidator(v *Validator) Option {
+	return func(r *Receiver) {
+		r.validator = v
+	}
+}
+
+// WithQuarantine - scans failing validation are put into quarantine instead of being just dropped,
+// it's also the default quarantine of SkewQuarantine (see SkewPolicy.Quarantine)
+func WithQuarantine(q Quarantine) Option {
+	return func(r *Receiver) {
+		r.quarantine = q
+	}
+}
+
+// SkewAction - what to do with scans from the future
+type SkewAction uint8
+
+const (
+	// SkewReject - reject the scan with *ValidationError
+	SkewReject SkewAction = iota
+	// SkewClamp - store the scan with the processing time as its timestamp
+	SkewClamp
+	// SkewQuarantine - put the scan into quarantine (see SkewPolicy.Quarantine) and reject it
+	SkewQuarantine
 )
 
+// ParseSkewAction - converts an action name (reject, clamp, quarantine) into SkewAction
+func ParseSkewAction(name string) (SkewAction, error) {
+	switch name {
+	case "reject":
+		return SkewReject, nil
+	case "clamp":
+		return SkewClamp, nil
+	case "quarantine":
+		return SkewQuarantine, nil
+	default:
+		return 0, fmt.Errorf("unknown skew action %q", name)
+	}
+}
+
+// SkewPolicy - protects stored records from scanners with bad clocks: a single scan far in the future
+// would otherwise block every legitimate update of its record until that time comes
+type SkewPolicy struct {
+	// MaxSkew - scans with timestamps beyond processing time plus MaxSkew are handled by Action
+	MaxSkew time.Duration
+	Action  SkewAction
+	// Now - clock, time.Now if not set
+	Now func() time.Time
+	// Quarantine - where SkewQuarantine puts the scans, the validation quarantine (see WithQuarantine) if not set
+	Quarantine Quarantine
+}
+
+// WithSkewPolicy - handles scans from the future according to the policy
+func WithSkewPolicy(p SkewPolicy) Option {
+	return func(r *Receiver) {
+		if p.Now == nil {
+			p.Now = time.Now
+		}
+		r.skew = &p
+	}
+}
+
 // Receiver - receives scanning results and stores it in some storage
 type Receiver struct {
-	storage Storage
+	storage      Storage
+	validator    *Validator
+	quarantine   Quarantine
+	skew         *SkewPolicy
+	redactor     *Redactor
+	interceptors []Interceptor
+	// chained - built-in and custom interceptors in the order they run
+	chained []Interceptor
+	handler Handler
+	clamped atomic.Uint64
 }
 
 // New - Receiver constructor
-func New(storage Storage) (*Receiver, error) {
+func New(storage Storage, opts ...Option) (*Receiver, error) {
 	if storage == nil {
 		return nil, fmt.Errorf("cannot instantiate Receiver, no storage provided")
 	}
-	return &Receiver{storage: storage}, nil
+	r := &Receiver{storage: storage}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.skew != nil && r.skew.Action == SkewQuarantine && r.skew.Quarantine == nil {
+		if r.quarantine == nil {
+			return nil, fmt.Errorf("cannot instantiate Receiver, skew quarantine requires a quarantine")
+		}
+		r.skew.Quarantine = r.quarantine
+	}
+
+	// built-in checks come first, so custom interceptors only ever see scans which are going to be stored
+	var interceptors []Interceptor
+	if r.redactor != nil {
+		interceptors = append(interceptors, r.redactor.redacting)
+	}
+	if r.validator != nil {
+		interceptors = append(interceptors, r.validating)
+	}
+	if r.skew != nil {
+		interceptors = append(interceptors, r.checkingSkew)
+	}
+	r.chained = append(interceptors, r.interceptors...)
+	r.handler = chain(r.chained, func(ctx context.Context, scn *ScanResult) (database.Result, error) {
+		return r.storage.Put(ctx, scn)
+	})
+	return r, nil
 }
 
 // Process - store a scanning result in a storage
-// returns OK if the record was updated, otherwise returns false
-// in case if storage operation fails - returns an error
-func (r *Receiver) Process(ctx context.Context, scn *ScanResult) (int64, error) {
-	return r.storage.Put(ctx, scn)
+// returns the result of storing the scan, its Change tells whether the scan is new, changed, unchanged, stale or reappeared
+// in case if storage operation fails - returns an error and the database.Unknown outcome
+// rejected scans are reported with the database.Rejected outcome along with the rejection error, the Reason of the result
+// is the Reason of *ValidationError, ReasonDropped or ReasonUndecodable
+// scans which were not built by NewScanResult are rejected with *DecodeError,
+// so a placeholder never replaces real data in the storage
+// scans failing validation are rejected with *ValidationError (after being quarantined, if configured)
+// scans dropped by interceptors (see WithInterceptors) are reported with ErrDropped
+func (r *Receiver) Process(ctx context.Context, scn *ScanResult) (database.Result, error) {
+	if err := checkDecoded(scn); err != nil {
+		return resultOf(database.Result{}, err)
+	}
+	return resultOf(r.handler(ctx, scn))
+}
+
+// resultOf - the handler result with rejections told apart from failures, whichever interceptor rejected the scan
+func resultOf(res database.Result, err error) (database.Result, error) {
+	if err == nil || res.Outcome == database.Rejected {
+		return res, err
+	}
+	var (
+		validationErr *ValidationError
+		decodeErr     *DecodeError
+	)
+	switch {
+	case errors.As(err, &validationErr):
+		return database.Rejection(string(validationErr.Reason)), err
+	case errors.Is(err, ErrDropped):
+		return database.Rejection(string(ReasonDropped)), err
+	case errors.As(err, &decodeErr):
+		return database.Rejection(string(ReasonUndecodable)), err
+	default:
+		return database.Result{}, err
+	}
+}
+
+// checkDecoded - rejects scans which were not built by NewScanResult
+func checkDecoded(scn *ScanResult) error {
+	if scn == nil {
+		return &DecodeError{Kind: ErrEmptyResponse}
+	}
+	if !DefaultRegistry.Supports(scn.Version()) {
+		return &DecodeError{Version: scn.Version(), Kind: ErrUnsupportedVersion}
+	}
+	if scn.Data() == "" {
+		return &DecodeError{Version: scn.Version(), Kind: ErrEmptyResponse}
+	}
+	return nil
+}
+
+// Clamped - number of scans stored with clamped timestamps
+func (r *Receiver) Clamped() uint64 {
+	return r.clamped.Load()
+}
+
+// checkingSkew - SkewPolicy interceptor
+func (r *Receiver) checkingSkew(ctx context.Context, scn *ScanResult, next Handler) (database.Result, error) {
+	now := r.skew.Now()
+	if scn.Timestamp() <= now.Add(r.skew.MaxSkew).Unix() {
+		return next(ctx, scn)
+	}
+	validationErr := &ValidationError{Reason: ReasonTimestampInFuture, Field: "timestamp", Value: scn.Timestamp()}
+	switch r.skew.Action {
+	case SkewClamp:
+		r.clamped.Add(1)
+		return next(ctx, scn.withTimestamp(now.Unix()))
+	case SkewQuarantine:
+		return database.Result{}, reject(ctx, r.skew.Quarantine, scn, validationErr)
+	default:
+		return database.Result{}, validationErr
+	}
+}
+
+// validating - Validator interceptor
+func (r *Receiver) validating(ctx context.Context, scn *ScanResult, next Handler) (database.Result, error) {
+	err := r.validator.Validate(scn)
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return database.Result{}, reject(ctx, r.quarantine, scn, validationErr)
+	}
+	if err != nil {
+		return database.Result{}, err
+	}
+	return next(ctx, scn)
+}
+
+// reject - quarantines the scan unless quarantine is nil, returns the rejection error
+func reject(ctx context.Context, quarantine Quarantine, scn *ScanResult, validationErr *ValidationError) error {
+	if quarantine == nil {
+		return validationErr
+	}
+	if err := quarantine.Quarantine(ctx, scn, string(validationErr.Reason)); err != nil {
+		// the scan would be lost otherwise - fail, so it's retried
+		return fmt.Errorf("cannot quarantine invalid scan (%s): %w", validationErr, err)
+	}
+	return validationErr
 }
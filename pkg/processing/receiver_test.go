@@ -2,6 +2,7 @@ package processing
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sync"
 	"testing"
@@ -10,6 +11,7 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/memory"
 	"github.com/igorvan/scan-takehome/pkg/scanning"
 )
 
@@ -19,19 +21,60 @@ type storageMock struct {
 	nextErr error
 }
 
-func (sm *storageMock) Put(_ context.Context, scan database.Scan) (int64, error) {
+func (sm *storageMock) Put(_ context.Context, scan database.Scan) (database.Result, error) {
 	if sm.nextErr != nil {
-		return 0, sm.nextErr
+		return database.Result{}, sm.nextErr
 	}
 	sm.mtx.Lock()
 	defer sm.mtx.Unlock()
-	if existingScan, ok := sm.data[database.Hash(scan)]; ok {
-		if existingScan.Timestamp() > scan.Timestamp() {
-			return 0, nil
-		}
+	existingScan, ok := sm.data[database.Hash(scan)]
+	if ok && existingScan.Timestamp() > scan.Timestamp() {
+		return database.Result{Outcome: database.Stale}, nil
 	}
 	sm.data[database.Hash(scan)] = scan
-	return 1, nil
+	if ok {
+		return database.Result{Outcome: database.Updated}, nil
+	}
+	return database.Result{Outcome: database.Inserted}, nil
+}
+
+// logRecorder - Logger which keeps the error messages
+type logRecorder struct {
+	mtx    sync.Mutex
+	errors []string
+}
+
+func (l *logRecorder) Error(msg string, _ ...any) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.errors = append(l.errors, msg)
+}
+
+func (l *logRecorder) Info(string, ...any) {}
+
+// raw - marshals the test scan data just like the scanner does
+func raw(data any) json.RawMessage {
+	b, _ := json.Marshal(data)
+	return b
+}
+
+// mustScanResult - NewScanResult for test data known to be valid
+func mustScanResult(timestamp int64, data any, version uint8) *ScanResult {
+	return mustHostScanResult("10.10.10.10", timestamp, data, version)
+}
+
+// mustHostScanResult - mustScanResult of the host, the IP isn't validated by NewScanResult
+func mustHostScanResult(ip string, timestamp int64, data any, version uint8) *ScanResult {
+	res, err := NewScanResult(ip, 99, "AWESOME", timestamp, raw(data), version)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// mustV2ScanResult - mustHostScanResult with the V2 response
+func mustV2ScanResult(ip string, timestamp int64, response string) *ScanResult {
+	return mustHostScanResult(ip, timestamp, scanning.V2Data{ResponseStr: response}, scanning.V2)
 }
 
 type ReceiverSuite struct {
@@ -43,37 +86,36 @@ func TestReceiverSuite(t *testing.T) {
 }
 
 func (s *ReceiverSuite) TestPut() {
-	scanR := NewScanResult("10.10.10.10", 99, "AWESOME", time.Now().Unix(),
-		scanning.V2Data{ResponseStr: "something initial"}, scanning.V2)
+	scanR := mustScanResult(time.Now().Unix(), scanning.V2Data{ResponseStr: "something initial"}, scanning.V2)
 	testCases := []struct {
-		title                string
-		expectedAffectedRows int64
-		expectedErr          error
-		dbErr                error
-		input                *ScanResult
-		dbData               map[uint64]database.Scan
+		title           string
+		expectedOutcome database.Outcome
+		expectedErr     error
+		dbErr           error
+		input           *ScanResult
+		dbData          map[uint64]database.Scan
 	}{
 		{
-			title:                "Success - new row added",
-			dbData:               map[uint64]database.Scan{},
-			expectedAffectedRows: 1,
-			input:                scanR,
+			title:           "Success - new row added",
+			dbData:          map[uint64]database.Scan{},
+			expectedOutcome: database.Inserted,
+			input:           scanR,
 		},
 		{
-			title:                "Failure - db error",
-			dbData:               map[uint64]database.Scan{},
-			expectedAffectedRows: 0,
-			input:                scanR,
-			dbErr:                fmt.Errorf("database internal error"),
-			expectedErr:          fmt.Errorf("database internal error"),
+			title:           "Failure - db error",
+			dbData:          map[uint64]database.Scan{},
+			expectedOutcome: database.Unknown,
+			input:           scanR,
+			dbErr:           fmt.Errorf("database internal error"),
+			expectedErr:     fmt.Errorf("database internal error"),
 		},
 		{
 			title: "Success - no rows updated",
 			dbData: map[uint64]database.Scan{
 				database.Hash(scanR): scanR,
 			},
-			expectedAffectedRows: 0,
-			input: NewScanResult("10.10.10.10", 99, "AWESOME", time.Now().Add(-10*time.Second).Unix(),
+			expectedOutcome: database.Stale,
+			input: mustScanResult(time.Now().Add(-10*time.Second).Unix(),
 				scanning.V2Data{ResponseStr: "something else"}, scanning.V2),
 		},
 		{
@@ -81,8 +123,8 @@ func (s *ReceiverSuite) TestPut() {
 			dbData: map[uint64]database.Scan{
 				database.Hash(scanR): scanR,
 			},
-			expectedAffectedRows: 1,
-			input: NewScanResult("10.10.10.10", 99, "AWESOME", time.Now().Add(10*time.Second).Unix(),
+			expectedOutcome: database.Updated,
+			input: mustScanResult(time.Now().Add(10*time.Second).Unix(),
 				scanning.V2Data{ResponseStr: "something else"}, scanning.V2),
 		},
 	}
@@ -98,11 +140,11 @@ func (s *ReceiverSuite) TestPut() {
 			s.NoError(err)
 			s.NotNil(receiver)
 
-			n, err := receiver.Process(context.TODO(), tc.input)
+			res, err := receiver.Process(context.TODO(), tc.input)
 			s.Equal(tc.expectedErr, err)
-			s.Equal(tc.expectedAffectedRows, n)
+			s.Equal(tc.expectedOutcome, res.Outcome)
 			dbRow, ok := mock.data[database.Hash(tc.input)]
-			if tc.expectedAffectedRows > 0 {
+			if tc.expectedOutcome.Written() {
 				// should be updated
 				s.True(ok)
 				s.Equal(dbRow.Data(), tc.input.Data())
@@ -116,41 +158,129 @@ func (s *ReceiverSuite) TestPut() {
 	}
 }
 
+func (s *ReceiverSuite) TestRejectInvalid() {
+	mock := &storageMock{data: map[uint64]database.Scan{}}
+	receiver, err := New(mock)
+	s.NoError(err)
+
+	testCases := []struct {
+		title        string
+		input        *ScanResult
+		expectedKind error
+	}{
+		{title: "Nil", input: nil, expectedKind: ErrEmptyResponse},
+		{title: "Not constructed", input: &ScanResult{version: scanning.V2}, expectedKind: ErrEmptyResponse},
+		{title: "Unsupported version", input: &ScanResult{version: 42}, expectedKind: ErrUnsupportedVersion},
+	}
+	for _, tc := range testCases {
+		s.Run(tc.title, func() {
+			res, err := receiver.Process(context.TODO(), tc.input)
+			var decodeErr *DecodeError
+			s.ErrorAs(err, &decodeErr)
+			s.ErrorIs(err, tc.expectedKind)
+			s.Equal(database.Rejection(string(ReasonUndecodable)), res)
+			s.Empty(mock.data)
+		})
+	}
+}
+
 func (s *ReceiverSuite) TestData() {
 	testCases := []struct {
 		title          string
-		input          *ScanResult
+		data           json.RawMessage
+		version        uint8
 		expectedResult string
+		expectedKind   error
 	}{
 		{
-			title: "V1 GOOD data",
-			input: NewScanResult("10.10.10.10", 99, "AWESOME", time.Now().Unix(),
-				scanning.V1Data{ResponseBytesUtf8: []byte("something super nice")}, scanning.V1),
+			title:          "V1 GOOD data",
+			data:           raw(scanning.V1Data{ResponseBytesUtf8: []byte("something super nice")}),
+			version:        scanning.V1,
 			expectedResult: "something super nice",
 		},
 		{
-			title: "V2 GOOD data",
-			input: NewScanResult("10.10.10.10", 99, "AWESOME", time.Now().Unix(),
-				scanning.V2Data{ResponseStr: "another version of something super nice"}, scanning.V2),
+			title:          "V2 GOOD data",
+			data:           raw(scanning.V2Data{ResponseStr: "another version of something super nice"}),
+			version:        scanning.V2,
 			expectedResult: "another version of something super nice",
 		},
 		{
-			title: "V1 CORRUPT data",
-			input: NewScanResult("10.10.10.10", 99, "AWESOME", time.Now().Unix(),
-				"", scanning.V1),
-			expectedResult: unknown,
+			title: "V3 GOOD data",
+			data: raw(scanning.V3Data{Response: []byte("structured something super nice"),
+				Details: scanning.Details{Transport: scanning.TransportTCP}}),
+			version:        scanning.V3,
+			expectedResult: "structured something super nice",
+		},
+		{
+			title:        "V1 CORRUPT data",
+			data:         raw(""),
+			version:      scanning.V1,
+			expectedKind: ErrMalformedPayload,
+		},
+		{
+			title:        "V2 CORRUPT data",
+			data:         raw(struct{ boolField bool }{}),
+			version:      scanning.V2,
+			expectedKind: ErrEmptyResponse,
 		},
 		{
-			title: "V2 CORRUPT data",
-			input: NewScanResult("10.10.10.10", 99, "AWESOME", time.Now().Unix(),
-				struct{ boolField bool }{}, scanning.V2),
-			expectedResult: unknown,
+			title:        "V2 EMPTY response",
+			data:         raw(scanning.V2Data{}),
+			version:      scanning.V2,
+			expectedKind: ErrEmptyResponse,
+		},
+		{
+			title:        "Unsupported version",
+			data:         raw(scanning.V2Data{ResponseStr: "from the future"}),
+			version:      42,
+			expectedKind: ErrUnsupportedVersion,
 		},
 	}
 
 	for _, tc := range testCases {
 		s.Run(tc.title, func() {
-			s.Equal(tc.expectedResult, tc.input.Data())
+			res, err := NewScanResult("10.10.10.10", 99, "AWESOME", time.Now().Unix(), tc.data, tc.version)
+			if tc.expectedKind != nil {
+				var decodeErr *DecodeError
+				s.ErrorAs(err, &decodeErr)
+				s.Equal(tc.version, decodeErr.Version)
+				s.ErrorIs(err, tc.expectedKind)
+				s.Nil(res)
+				return
+			}
+			s.NoError(err)
+			s.Equal(tc.expectedResult, res.Data())
 		})
 	}
 }
+
+func (s *ReceiverSuite) TestDetails() {
+	details := scanning.Details{
+		Transport:     scanning.TransportTCP,
+		Request:       []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"),
+		LatencyMicros: 1800,
+		TLS:           &scanning.TLSInfo{Version: "TLS 1.3", CipherSuite: "TLS_AES_128_GCM_SHA256", ServerName: "example.com"},
+		Sections:      map[string]json.RawMessage{"http": json.RawMessage(`{"redirects":1}`)},
+	}
+	scn, err := NewScanResult("10.10.10.10", 443, "HTTP", time.Now().Unix(),
+		raw(scanning.V3Data{Response: []byte("HTTP/1.1 200 OK\r\nServer: nginx\r\n\r\n"), Details: details}), scanning.V3)
+	s.Require().NoError(err)
+	s.Equal(&details, scn.Details())
+	// the response is parsed the same way as for any other version
+	s.Equal("nginx", scn.Fields()["header.server"])
+	// annotated copies keep the details
+	s.Equal(&details, scn.Annotate("k", "v").Details())
+
+	store := memory.New()
+	receiver, err := New(store)
+	s.Require().NoError(err)
+	res, err := receiver.Process(context.TODO(), scn)
+	s.NoError(err)
+	s.Equal(database.Inserted, res.Outcome)
+	rows, err := store.GetAll(context.TODO())
+	s.NoError(err)
+	s.Equal(&details, rows[database.Hash(scn)].Details)
+
+	v2 := mustScanResult(time.Now().Unix(), scanning.V2Data{ResponseStr: "no details"}, scanning.V2)
+	s.Nil(v2.Details())
+}
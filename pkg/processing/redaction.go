@@ -0,0 +1,295 @@
+package processing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/igorvan/scan-takehome/pkg/charset"
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
+// FieldRedacted - names of the redaction rules which matched the scan, comma-separated and sorted
+const FieldRedacted = "redacted"
+
+// RedactedPlaceholder - replaces every redacted secret
+const RedactedPlaceholder = "[REDACTED]"
+
+// secretGroup - capture group name which limits the redaction to a part of the match
+const secretGroup = "secret"
+
+// RedactionRule - secrets matched by Pattern are replaced with RedactedPlaceholder,
+// if the pattern has a capture group named "secret" only the group is replaced, e.g. the cookie value but not the header name
+type RedactionRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// ParseRedactionRule - rule out of "name=pattern"
+func ParseRedactionRule(s string) (RedactionRule, error) {
+	name, pattern, ok := strings.Cut(s, "=")
+	if !ok || name == "" || pattern == "" {
+		return RedactionRule{}, fmt.Errorf("invalid redaction rule %q, name=pattern expected", s)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return RedactionRule{}, fmt.Errorf("invalid redaction rule %q: %w", name, err)
+	}
+	return RedactionRule{Name: name, Pattern: re}, nil
+}
+
+// DefaultRedactionRules - built-in detectors of cookies, authorization headers, URL credentials, private keys
+// and API keys of the most common providers
+func DefaultRedactionRules() []RedactionRule {
+	return []RedactionRule{
+		{Name: "cookie", Pattern: regexp.MustCompile(`(?im)^(?:set-)?cookie:[ \t]*(?P<secret>[^\r\n]+)`)},
+		{Name: "authorization", Pattern: regexp.MustCompile(`(?im)^(?:proxy-)?authorization:[ \t]*(?P<secret>[^\r\n]+)`)},
+		{Name: "url-credentials", Pattern: regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.-]*://[^/\s:@]+:(?P<secret>[^/\s@]+)@`)},
+		{Name: "private-key", Pattern: regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?(?:-----END [A-Z ]*PRIVATE KEY-----|$)`)},
+		{Name: "jwt", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+		{Name: "aws-access-key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{Name: "github-token", Pattern: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+		{Name: "slack-token", Pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+		{Name: "google-api-key", Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+		{Name: "stripe-key", Pattern: regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}`)},
+	}
+}
+
+// Redactor - removes secrets from scans before they are stored, see WithRedactor
+type Redactor struct {
+	rules      []RedactionRule
+	mtx        sync.Mutex
+	redactions map[string]uint64
+}
+
+// NewRedactor - Redactor constructor, rule names must be unique
+func NewRedactor(rules ...RedactionRule) (*Redactor, error) {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("cannot instantiate Redactor without rules")
+	}
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Name == "" || strings.Contains(rule.Name, ",") || rule.Pattern == nil {
+			return nil, fmt.Errorf("invalid redaction rule %q", rule.Name)
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("redaction rule %q is defined twice", rule.Name)
+		}
+		seen[rule.Name] = true
+	}
+	return &Redactor{rules: rules, redactions: map[string]uint64{}}, nil
+}
+
+// WithRedactor - redacts secrets from every scan before anything else happens to it,
+// so neither the storage nor the quarantine ever sees them
+func WithRedactor(rd *Redactor) Option {
+	return func(r *Receiver) {
+		r.redactor = rd
+	}
+}
+
+// Redact - data with the secrets replaced, and the names of the rules which matched in the order of rules,
+// data is returned as it is if nothing matched
+func (rd *Redactor) Redact(data []byte) ([]byte, []string) {
+	var matched []string
+	for _, rule := range rd.rules {
+		var (
+			group = rule.Pattern.SubexpIndex(secretGroup)
+			res   []byte
+			last  int
+		)
+		for _, m := range rule.Pattern.FindAllSubmatchIndex(data, -1) {
+			start, end := m[0], m[1]
+			if group > 0 {
+				start, end = m[2*group], m[2*group+1]
+			}
+			// nothing to redact, the group didn't participate in the match, or it's already redacted
+			if start == end || bytes.Equal(data[start:end], []byte(RedactedPlaceholder)) {
+				continue
+			}
+			res = append(res, data[last:start]...)
+			res = append(res, RedactedPlaceholder...)
+			last = end
+		}
+		if res == nil {
+			continue
+		}
+		data = append(res, data[last:]...)
+		matched = append(matched, rule.Name)
+	}
+	return data, matched
+}
+
+// Redactions - number of redacted scans by rule
+func (rd *Redactor) Redactions() map[string]uint64 {
+	rd.mtx.Lock()
+	defer rd.mtx.Unlock()
+	return maps.Clone(rd.redactions)
+}
+
+// redacting - Redactor interceptor
+func (rd *Redactor) redacting(ctx context.Context, scn *ScanResult, next Handler) (database.Result, error) {
+	if res, ok := rd.redact(scn); ok {
+		scn = res
+	}
+	return next(ctx, scn)
+}
+
+// redact - copy of the scan without secrets in its response, fields and details, false if there were none
+func (rd *Redactor) redact(scn *ScanResult) (*ScanResult, bool) {
+	matched := map[string]bool{}
+	res := *scn
+
+	response, names := rd.Redact(scn.response)
+	for _, name := range names {
+		matched[name] = true
+	}
+	fields := maps.Clone(scn.fields)
+	if len(names) > 0 {
+		res.response = response
+		res.charset = charset.Detect(response)
+		// parsed fields are parsed anew out of the redacted response, e.g. header.set-cookie carries no header name to match,
+		// while fields added by interceptors are kept
+		parsed, _ := DefaultParsers.Parse(scn.service, scn.response)
+		for k := range parsed {
+			delete(fields, k)
+		}
+		reparsed, _ := DefaultParsers.Parse(scn.service, response)
+		if fields == nil && len(reparsed) > 0 {
+			fields = map[string]string{}
+		}
+		maps.Copy(fields, reparsed)
+	}
+	for k, v := range fields {
+		redacted, names := rd.Redact([]byte(v))
+		if len(names) == 0 {
+			continue
+		}
+		fields[k] = string(redacted)
+		for _, name := range names {
+			matched[name] = true
+		}
+	}
+	if details, names := rd.redactDetails(scn.details); len(names) > 0 {
+		res.details = details
+		for _, name := range names {
+			matched[name] = true
+		}
+	}
+	if len(matched) == 0 {
+		return scn, false
+	}
+	rd.mtx.Lock()
+	for name := range matched {
+		rd.redactions[name]++
+	}
+	rd.mtx.Unlock()
+
+	// a scan may be redacted more than once, e.g. by differently configured redactors
+	for _, name := range strings.Split(fields[FieldRedacted], ",") {
+		if name != "" {
+			matched[name] = true
+		}
+	}
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	fields[FieldRedacted] = strings.Join(slices.Sorted(maps.Keys(matched)), ",")
+	res.fields = fields
+	return &res, true
+}
+
+// redactDetails - copy of the details without secrets in the request, the TLS strings and the sections,
+// and the names of the rules which matched, nil if nothing matched
+func (rd *Redactor) redactDetails(details *scanning.Details) (*scanning.Details, []string) {
+	if details == nil {
+		return nil, nil
+	}
+	var matched []string
+	redact := func(data []byte) []byte {
+		redacted, names := rd.Redact(data)
+		matched = append(matched, names...)
+		return redacted
+	}
+	res := details.Clone()
+	if len(res.Request) > 0 {
+		res.Request = redact(res.Request)
+	}
+	if res.TLS != nil {
+		for _, v := range []*string{&res.TLS.Version, &res.TLS.CipherSuite, &res.TLS.ServerName, &res.TLS.ALPN,
+			&res.TLS.CertSHA256, &res.TLS.CertSubject, &res.TLS.CertIssuer} {
+			*v = string(redact([]byte(*v)))
+		}
+	}
+	for k, section := range res.Sections {
+		redacted, names := rd.redactJSON(section)
+		res.Sections[k] = redacted
+		matched = append(matched, names...)
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+	return res, matched
+}
+
+// redactJSON - JSON document with the secrets in its string values redacted, so it stays valid JSON,
+// and the names of the rules which matched, the document is returned as it is if nothing matched
+// string members of objects are matched as "name: value" lines, so e.g. headers are redacted like the ones of the response
+func (rd *Redactor) redactJSON(doc json.RawMessage) (json.RawMessage, []string) {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		// sections are validated when they are received, a broken one is redacted as it is
+		redacted, names := rd.Redact(doc)
+		return redacted, names
+	}
+	var matched []string
+	v = rd.redactValue("", v, &matched)
+	if len(matched) == 0 {
+		return doc, nil
+	}
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		redacted, names := rd.Redact(doc)
+		return redacted, names
+	}
+	return redacted, matched
+}
+
+// redactValue - the decoded JSON value with the secrets in its strings redacted, name is the object member name, if any
+func (rd *Redactor) redactValue(name string, v any, matched *[]string) any {
+	switch v := v.(type) {
+	case string:
+		if name != "" {
+			prefix := name + ": "
+			redacted, names := rd.Redact([]byte(prefix + v))
+			if len(names) > 0 && bytes.HasPrefix(redacted, []byte(prefix)) {
+				*matched = append(*matched, names...)
+				return string(redacted[len(prefix):])
+			}
+		}
+		redacted, names := rd.Redact([]byte(v))
+		if len(names) == 0 {
+			return v
+		}
+		*matched = append(*matched, names...)
+		return string(redacted)
+	case []any:
+		for i, e := range v {
+			v[i] = rd.redactValue("", e, matched)
+		}
+	case map[string]any:
+		for k, e := range v {
+			v[k] = rd.redactValue(k, e, matched)
+		}
+	}
+	return v
+}
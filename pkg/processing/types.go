@@ -3,64 +3,86 @@ package processing
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 
+	"github.com/igorvan/scan-takehome/pkg/charset"
 	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
 )
 
-const (
-	// Version - supported scanning data versions
-	Version = iota
-	// V1 - older - base64 encoded string
-	V1
-	// V2 - newer - decoded string
-	V2
-	unknown = "unknown"
-)
-
-// V1Data - bytes
-type V1Data struct {
-	ResponseBytesUtf8 []byte `json:"response_bytes_utf8"`
-}
-
-// V2Data - string
-type V2Data struct {
-	ResponseStr string `json:"response_str"`
-}
-
 // Storage - scanning results storage
 type Storage interface {
-	Put(ctx context.Context, scan database.Scan) (int64, error)
+	Put(ctx context.Context, scan database.Scan) (database.Result, error)
+}
+
+// BatchStorage - Storage which writes many scans at once, returns Put results in the order of scans
+// if it fails, none of the scans should be considered written (some may be, retrying them is safe)
+type BatchStorage interface {
+	Storage
+	PutBatch(ctx context.Context, scans []database.Scan) ([]database.Result, error)
 }
 
 // ScanResult - domain scan result,
 // for now the only difference from the client's counterpart is immutability
 type ScanResult struct {
-	ip          string
-	port        uint32
-	service     string
-	timestamp   int64
-	rawData     any
-	version     uint8
-	decodedData string
+	ip        string
+	port      uint32
+	service   string
+	timestamp int64
+	version   uint8
+	response  []byte
+	charset   string
+	fields    map[string]string
+	details   *scanning.Details
 }
 
-// NewScanResult - ScanResult constructor
+// NewScanResult - ScanResult constructor, the raw JSON data is decoded right away
+// with the decoder registered for its version, so it's never decoded twice
+// returns *DecodeError if the data cannot be decoded,
+// the response is parsed with the parser registered for the service (see DefaultParsers), if any
 func NewScanResult(
 	ip string,
 	port uint32,
 	service string,
 	timestamp int64,
-	rawData any,
+	rawData json.RawMessage,
 	version uint8,
-) *ScanResult {
+) (*ScanResult, error) {
+	response, details, err := DefaultRegistry.DecodeDetails(version, rawData)
+	if err != nil {
+		return nil, err
+	}
+	return newScanResult(ip, port, service, timestamp, version, response, details), nil
+}
+
+// ScanResultOf - ScanResult of the received scan, like NewScanResult, but the data already decoded
+// by the wire format (protobuf messages, see scanning.Scan.Decoded) is taken as it is
+func ScanResultOf(scan *scanning.Scan) (*ScanResult, error) {
+	if scan.Decoded == nil {
+		return NewScanResult(scan.Ip, scan.Port, scan.Service, scan.Timestamp, scan.Data, uint8(scan.DataVersion))
+	}
+	version := uint8(scan.DataVersion)
+	response, details, err := DefaultRegistry.DecodeValue(version, scan.Decoded)
+	if err != nil {
+		return nil, err
+	}
+	return newScanResult(scan.Ip, scan.Port, scan.Service, scan.Timestamp, version, response, details), nil
+}
+
+// newScanResult - ScanResult of the decoded response
+func newScanResult(ip string, port uint32, service string, timestamp int64, version uint8,
+	response []byte, details *scanning.Details) *ScanResult {
+	// responses that don't parse are still valid scans, they just don't have structured fields
+	fields, _ := DefaultParsers.Parse(service, response)
 	return &ScanResult{
 		ip:        ip,
 		port:      port,
 		version:   version,
-		rawData:   rawData,
 		timestamp: timestamp,
 		service:   service,
+		response:  response,
+		charset:   charset.Detect(response),
+		fields:    fields,
+		details:   details,
 	}
 }
 
@@ -69,19 +91,37 @@ func (s *ScanResult) IP() string {
 	return s.ip
 }
 
-// Data - scanned service response
+// Data - scanned service response, byte for byte (not necessarily valid UTF-8, see Charset)
 func (s *ScanResult) Data() string {
-	if s.decodedData != "" {
-		return s.decodedData
-	}
-	b, err := json.Marshal(s.rawData)
-	if err != nil {
-		fmt.Println(fmt.Sprintf("cannot marshal [%s] - error:", s.rawData), err)
-		s.decodedData = unknown
-		return s.decodedData
-	}
-	s.decodedData = unmarshalData(s.version, b)
-	return s.decodedData
+	return string(s.response)
+}
+
+// Response - raw scanned service response bytes, must not be modified
+func (s *ScanResult) Response() []byte {
+	return s.response
+}
+
+// Charset - detected charset of the service response
+func (s *ScanResult) Charset() string {
+	return s.charset
+}
+
+// Fields - structured fields parsed from the service response, nil if there are none, must not be modified
+func (s *ScanResult) Fields() map[string]string {
+	return s.fields
+}
+
+// Details - details of the scanner's exchange with the service, nil unless the data version carries them (V3),
+// must not be modified
+func (s *ScanResult) Details() *scanning.Details {
+	return s.details
+}
+
+// withTimestamp - copy of the scan result with another timestamp
+func (s *ScanResult) withTimestamp(timestamp int64) *ScanResult {
+	res := *s
+	res.timestamp = timestamp
+	return &res
 }
 
 // Service - scanned service name
@@ -103,32 +143,3 @@ func (s *ScanResult) Version() uint8 {
 func (s *ScanResult) Port() uint32 {
 	return s.port
 }
-
-func unmarshalData(version uint8, b []byte) string {
-	switch version {
-	case V1:
-		v1Data := unmarshal[V1Data](b)
-		if v1Data == nil || len(v1Data.ResponseBytesUtf8) == 0 {
-			return unknown
-		}
-		return string(v1Data.ResponseBytesUtf8)
-	case V2:
-		v2Data := unmarshal[V2Data](b)
-		if v2Data == nil || v2Data.ResponseStr == "" {
-			return unknown
-		}
-		return v2Data.ResponseStr
-	default:
-		return unknown
-	}
-}
-
-func unmarshal[T any](b []byte) *T {
-	var res T
-	err := json.Unmarshal(b, &res)
-	if err != nil {
-		fmt.Println(fmt.Sprintf("error unmarshaling scan result data [%s]:", b), err)
-		return nil
-	}
-	return &res
-}
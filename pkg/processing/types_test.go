@@ -0,0 +1,73 @@
+package processing
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
+// legacyScan - scan message as it was decoded before data was kept raw
+type legacyScan struct {
+	Ip          string      `json:"ip"`
+	Port        uint32      `json:"port"`
+	Service     string      `json:"service"`
+	Timestamp   int64       `json:"timestamp"`
+	DataVersion int         `json:"data_version"`
+	Data        interface{} `json:"data"`
+}
+
+func benchmarkMessages(b *testing.B) [][]byte {
+	b.Helper()
+	var messages [][]byte
+	for version, data := range map[int]any{
+		scanning.V1: scanning.V1Data{ResponseBytesUtf8: []byte("SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13.5")},
+		scanning.V2: scanning.V2Data{ResponseStr: "HTTP/1.1 200 OK\r\nServer: nginx/1.25.3\r\nContent-Type: text/html\r\n\r\n"},
+	} {
+		scan := &scanning.Scan{Ip: "1.1.1.1", Port: 22, Service: "SSH", Timestamp: 1700000000}
+		if err := scan.SetData(version, data); err != nil {
+			b.Fatal(err)
+		}
+		msg, err := json.Marshal(scan)
+		if err != nil {
+			b.Fatal(err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// BenchmarkDecode - message to service response, the way it's done now vs the JSON re-marshal round trip
+func BenchmarkDecode(b *testing.B) {
+	messages := benchmarkMessages(b)
+
+	b.Run("RawMessage", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			scan := &scanning.Scan{}
+			if err := json.Unmarshal(messages[i%len(messages)], scan); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := NewScanResult(scan.Ip, scan.Port, scan.Service, scan.Timestamp, scan.Data, uint8(scan.DataVersion)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("RemarshalRoundTrip", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			scan := &legacyScan{}
+			if err := json.Unmarshal(messages[i%len(messages)], scan); err != nil {
+				b.Fatal(err)
+			}
+			raw, err := json.Marshal(scan.Data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := DefaultRegistry.Decode(uint8(scan.DataVersion), raw); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
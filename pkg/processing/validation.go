@@ -0,0 +1,141 @@
+package processing
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxPort = 65535
+	// maxServiceLength - scan_results.service column size
+	maxServiceLength = 255
+)
+
+// ErrInvalidScan - the scan didn't pass validation, every *ValidationError matches it with errors.Is
+var ErrInvalidScan = errors.New("invalid scan")
+
+// Reason - scan rejection reason
+type Reason string
+
+// Rejection reasons
+const (
+	ReasonInvalidIP         Reason = "invalid_ip"
+	ReasonInvalidPort       Reason = "invalid_port"
+	ReasonEmptyService      Reason = "empty_service"
+	ReasonMalformedService  Reason = "malformed_service"
+	ReasonTimestampTooOld   Reason = "timestamp_too_old"
+	ReasonTimestampInFuture Reason = "timestamp_in_future"
+	// ReasonDropped - the scan was dropped by an interceptor, see ErrDropped
+	ReasonDropped Reason = "dropped"
+	// ReasonUndecodable - the scan was not built by NewScanResult, see DecodeError
+	ReasonUndecodable Reason = "undecodable"
+)
+
+// ValidationError - structured scan rejection
+type ValidationError struct {
+	Reason Reason
+	// Field - name of the offending scan field
+	Field string
+	// Value - the offending value
+	Value any
+}
+
+// Error - error message
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s %s=%v", ErrInvalidScan, e.Reason, e.Field, e.Value)
+}
+
+// Unwrap - makes ErrInvalidScan available to errors.Is
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidScan
+}
+
+// ValidationConfig - validation rules
+type ValidationConfig struct {
+	// ServicePattern - well-formed service names
+	ServicePattern *regexp.Regexp
+	// MinTimestamp - scans older than this are considered implausible, 0 disables the check
+	MinTimestamp int64
+	// MaxAhead - scans further in the future than this are considered implausible, 0 disables the check
+	MaxAhead time.Duration
+	// Now - clock, time.Now if not set
+	Now func() time.Time
+}
+
+// DefaultValidationConfig - sane validation rules
+func DefaultValidationConfig() ValidationConfig {
+	return ValidationConfig{
+		ServicePattern: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.+-]*$`),
+		// nothing we store could have been scanned before 2000-01-01
+		MinTimestamp: 946684800,
+		Now:          time.Now,
+	}
+}
+
+// Validator - checks scans before they are written, counts rejections by reason
+type Validator struct {
+	cfg        ValidationConfig
+	mtx        sync.Mutex
+	rejections map[Reason]uint64
+}
+
+// NewValidator - Validator constructor
+func NewValidator(cfg ValidationConfig) *Validator {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Validator{cfg: cfg, rejections: map[Reason]uint64{}}
+}
+
+// Validate - returns *ValidationError describing the first violated rule, nil for valid scans
+func (v *Validator) Validate(scn *ScanResult) error {
+	err := v.validate(scn)
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		v.mtx.Lock()
+		v.rejections[validationErr.Reason]++
+		v.mtx.Unlock()
+	}
+	return err
+}
+
+// Rejections - number of rejected scans by reason
+func (v *Validator) Rejections() map[Reason]uint64 {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	res := make(map[Reason]uint64, len(v.rejections))
+	for reason, n := range v.rejections {
+		res[reason] = n
+	}
+	return res
+}
+
+func (v *Validator) validate(scn *ScanResult) error {
+	addr, err := netip.ParseAddr(scn.IP())
+	if err != nil || addr.Zone() != "" {
+		return &ValidationError{Reason: ReasonInvalidIP, Field: "ip", Value: scn.IP()}
+	}
+	if scn.Port() > maxPort {
+		return &ValidationError{Reason: ReasonInvalidPort, Field: "port", Value: scn.Port()}
+	}
+	if scn.Service() == "" {
+		return &ValidationError{Reason: ReasonEmptyService, Field: "service", Value: scn.Service()}
+	}
+	// service names are comma-separated in the host rollup, so commas are never allowed
+	if len(scn.Service()) > maxServiceLength || strings.Contains(scn.Service(), ",") ||
+		(v.cfg.ServicePattern != nil && !v.cfg.ServicePattern.MatchString(scn.Service())) {
+		return &ValidationError{Reason: ReasonMalformedService, Field: "service", Value: scn.Service()}
+	}
+	if scn.Timestamp() <= 0 || scn.Timestamp() < v.cfg.MinTimestamp {
+		return &ValidationError{Reason: ReasonTimestampTooOld, Field: "timestamp", Value: scn.Timestamp()}
+	}
+	if v.cfg.MaxAhead > 0 && scn.Timestamp() > v.cfg.Now().Add(v.cfg.MaxAhead).Unix() {
+		return &ValidationError{Reason: ReasonTimestampInFuture, Field: "timestamp", Value: scn.Timestamp()}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+	"github.com/igorvan/scan-takehome/pkg/memory"
+	"github.com/igorvan/scan-takehome/pkg/scanning"
+)
+
+type quarantineMock struct {
+	reasons []string
+	scans   []database.Scan
+	err     error
+}
+
+func (q *quarantineMock) Quarantine(_ context.Context, scan database.Scan, reason string) error {
+	if q.err != nil {
+		return q.err
+	}
+	q.reasons = append(q.reasons, reason)
+	q.scans = append(q.scans, scan)
+	return nil
+}
+
+type ValidationSuite struct {
+	suite.Suite
+	now time.Time
+}
+
+func TestValidationSuite(t *testing.T) {
+	suite.Run(t, &ValidationSuite{now: time.Unix(1700000000, 0)})
+}
+
+func (s *ValidationSuite) scan(ip string, port uint32, service string, ts int64) *ScanResult {
+	res, err := NewScanResult(ip, port, service, ts, raw(scanning.V2Data{ResponseStr: "hi"}), scanning.V2)
+	s.Require().NoError(err)
+	return res
+}
+
+func (s *ValidationSuite) validator() *Validator {
+	cfg := DefaultValidationConfig()
+	cfg.MaxAhead = time.Hour
+	cfg.Now = func() time.Time { return s.now }
+	return NewValidator(cfg)
+}
+
+func (s *ValidationSuite) TestValidate() {
+	ts := s.now.Unix()
+	testCases := []struct {
+		title          string
+		input          *ScanResult
+		expectedReason Reason
+	}{
+		{title: "Valid IPv4", input: s.scan("1.1.1.1", 80, "HTTP", ts)},
+		{title: "Valid IPv6", input: s.scan("2001:db8::1", 65535, "SSH", ts)},
+		{title: "Valid service with punctuation", input: s.scan("1.1.1.1", 0, "x-ms.rpc_v2+tls", ts)},
+		{title: "Invalid IP", input: s.scan("1.1.1.256", 80, "HTTP", ts), expectedReason: ReasonInvalidIP},
+		{title: "Empty IP", input: s.scan("", 80, "HTTP", ts), expectedReason: ReasonInvalidIP},
+		{title: "IP with zone", input: s.scan("fe80::1%eth0", 80, "HTTP", ts), expectedReason: ReasonInvalidIP},
+		{title: "Invalid port", input: s.scan("1.1.1.1", 65536, "HTTP", ts), expectedReason: ReasonInvalidPort},
+		{title: "Empty service", input: s.scan("1.1.1.1", 80, "", ts), expectedReason: ReasonEmptyService},
+		{title: "Malformed service", input: s.scan("1.1.1.1", 80, "HT TP", ts), expectedReason: ReasonMalformedService},
+		{title: "Too long service", input: s.scan("1.1.1.1", 80, strings.Repeat("A", 256), ts), expectedReason: ReasonMalformedService},
+		{title: "Zero timestamp", input: s.scan("1.1.1.1", 80, "HTTP", 0), expectedReason: ReasonTimestampTooOld},
+		{title: "Ancient timestamp", input: s.scan("1.1.1.1", 80, "HTTP", 1000), expectedReason: ReasonTimestampTooOld},
+		{title: "Future timestamp", input: s.scan("1.1.1.1", 80, "HTTP", ts+7200), expectedReason: ReasonTimestampInFuture},
+	}
+
+	v := s.validator()
+	expectedRejections := map[Reason]uint64{}
+	for _, tc := range testCases {
+		s.Run(tc.title, func() {
+			err := v.Validate(tc.input)
+			if tc.expectedReason == "" {
+				s.NoError(err)
+				return
+			}
+			expectedRejections[tc.expectedReason]++
+			var validationErr *ValidationError
+			s.ErrorAs(err, &validationErr)
+			s.ErrorIs(err, ErrInvalidScan)
+			s.Equal(tc.expectedReason, validationErr.Reason)
+		})
+	}
+	s.Equal(expectedRejections, v.Rejections())
+}
+
+func (s *ValidationSuite) TestServiceWithComma() {
+	// commas break the host rollup service lists, so even a permissive pattern doesn't let them through
+	cfg := DefaultValidationConfig()
+	cfg.ServicePattern = nil
+	err := NewValidator(cfg).Validate(s.scan("1.1.1.1", 80, "HTTP,SSH", s.now.Unix()))
+	var validationErr *ValidationError
+	s.Require().ErrorAs(err, &validationErr)
+	s.Equal(ReasonMalformedService, validationErr.Reason)
+}
+
+func (s *ValidationSuite) TestReceiver() {
+	invalid := s.scan("1.1.1.1", 80, "", s.now.Unix())
+
+	// rejected
+	storage := &storageMock{data: map[uint64]database.Scan{}}
+	receiver, err := New(storage, WithValidator(s.validator()))
+	s.NoError(err)
+	res, err := receiver.Process(context.TODO(), invalid)
+	s.ErrorIs(err, ErrInvalidScan)
+	s.Equal(database.Rejection(string(ReasonEmptyService)), res)
+	s.Empty(storage.data)
+
+	// quarantined
+	quarantine := &quarantineMock{}
+	receiver, err = New(storage, WithValidator(s.validator()), WithQuarantine(quarantine))
+	s.NoError(err)
+	_, err = receiver.Process(context.TODO(), invalid)
+	s.ErrorIs(err, ErrInvalidScan)
+	s.Equal([]string{string(ReasonEmptyService)}, quarantine.reasons)
+	s.Empty(storage.data)
+
+	// quarantine is down - not an invalid scan error anymore, so it gets retried
+	quarantine.err = fmt.Errorf("quarantine is down")
+	res, err = receiver.Process(context.TODO(), invalid)
+	s.Error(err)
+	s.NotErrorIs(err, ErrInvalidScan)
+	s.Equal(database.Unknown, res.Outcome)
+
+	// valid scans go through
+	res, err = receiver.Process(context.TODO(), s.scan("1.1.1.1", 80, "HTTP", s.now.Unix()))
+	s.NoError(err)
+	s.Equal(database.Inserted, res.Outcome)
+}
+
+func (s *ValidationSuite) TestSkewPolicy() {
+	future := s.now.Add(time.Hour).Unix()
+	testCases := []struct {
+		title              string
+		action             SkewAction
+		input              *ScanResult
+		expectedErr        error
+		expectedTimestamp  int64
+		expectedQuarantine []string
+	}{
+		{
+			title:             "Within skew",
+			action:            SkewReject,
+			input:             s.scan("1.1.1.1", 80, "HTTP", s.now.Add(time.Minute).Unix()),
+			expectedTimestamp: s.now.Add(time.Minute).Unix(),
+		},
+		{
+			title:       "Rejected",
+			action:      SkewReject,
+			input:       s.scan("1.1.1.1", 80, "HTTP", future),
+			expectedErr: ErrInvalidScan,
+		},
+		{
+			title:             "Clamped",
+			action:            SkewClamp,
+			input:             s.scan("1.1.1.1", 80, "HTTP", future),
+			expectedTimestamp: s.now.Unix(),
+		},
+		{
+			title:              "Quarantined",
+			action:             SkewQuarantine,
+			input:              s.scan("1.1.1.1", 80, "HTTP", future),
+			expectedErr:        ErrInvalidScan,
+			expectedQuarantine: []string{string(ReasonTimestampInFuture)},
+		},
+	}
+	for _, tc := range testCases {
+		s.Run(tc.title, func() {
+			storage := &storageMock{data: map[uint64]database.Scan{}}
+			quarantine := &quarantineMock{}
+			receiver, err := New(storage, WithQuarantine(quarantine), WithSkewPolicy(SkewPolicy{
+				MaxSkew: 5 * time.Minute,
+				Action:  tc.action,
+				Now:     func() time.Time { return s.now },
+			}))
+			s.NoError(err)
+
+			_, err = receiver.Process(context.TODO(), tc.input)
+			s.Equal(tc.expectedQuarantine, quarantine.reasons)
+			if tc.expectedErr != nil {
+				s.ErrorIs(err, tc.expectedErr)
+				s.Empty(storage.data)
+				return
+			}
+			s.NoError(err)
+			s.Equal(tc.expectedTimestamp, storage.data[database.Hash(tc.input)].Timestamp())
+			if tc.action == SkewClamp {
+				// the original scan result stays untouched
+				s.Equal(future, tc.input.Timestamp())
+			}
+		})
+	}
+}
+
+func (s *ValidationSuite) TestSkewQuarantineTarget() {
+	future := s.now.Add(time.Hour).Unix()
+	policy := SkewPolicy{MaxSkew: 5 * time.Minute, Action: SkewQuarantine, Now: func() time.Time { return s.now }}
+	_, err := New(memory.New(), WithSkewPolicy(policy))
+	s.Error(err)
+
+	// skew quarantine doesn't make validation rejects quarantined, and works without validation quarantine
+	skewQuarantine := &quarantineMock{}
+	policy.Quarantine = skewQuarantine
+	receiver, err := New(memory.New(), WithValidator(s.validator()), WithSkewPolicy(policy))
+	s.Require().NoError(err)
+	_, err = receiver.Process(context.TODO(), s.scan("1.1.1.1", 80, "", s.now.Unix()))
+	s.ErrorIs(err, ErrInvalidScan)
+	_, err = receiver.Process(context.TODO(), s.scan("1.1.1.1", 80, "HTTP", future))
+	s.ErrorIs(err, ErrInvalidScan)
+	s.Equal([]string{string(ReasonTimestampInFuture)}, skewQuarantine.reasons)
+}
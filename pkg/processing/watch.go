@@ -0,0 +1,87 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/igorvan/scan-takehome/pkg/database"
+)
+
+// watchedFile - a file loaded into T, which can be replaced at any time, it's picked up by Reload or Watch
+type watchedFile[T any] struct {
+	path string
+	// name - what the file is, e.g. "GeoIP database"
+	name string
+	load func(r io.Reader) (*T, error)
+	// describe - summary of the loaded value, e.g. "3 networks"
+	describe func(v *T) string
+	log      database.Logger
+	current  atomic.Pointer[T]
+	modTime  atomic.Int64
+}
+
+// watchFile - watchedFile constructor, loads the file
+func watchFile[T any](path, name string, load func(r io.Reader) (*T, error), describe func(v *T) string,
+	log database.Logger) (*watchedFile[T], error) {
+	w := &watchedFile[T]{path: path, name: name, load: load, describe: describe, log: database.NewNullSafeLogger(log)}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Load - the value loaded from the file most recently
+func (w *watchedFile[T]) Load() *T {
+	return w.current.Load()
+}
+
+// Reload - re-reads the file, the current value stays in use if the file cannot be loaded
+func (w *watchedFile[T]) Reload() error {
+	f, err := os.Open(w.path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	v, err := w.load(f)
+	if err != nil {
+		return fmt.Errorf("cannot load %s %s: %w", w.name, w.path, err)
+	}
+	w.current.Store(v)
+	w.modTime.Store(info.ModTime().UnixNano())
+	w.log.Info(fmt.Sprintf("%s %s is loaded: %s", w.name, w.path, w.describe(v)))
+	return nil
+}
+
+// Watch - reloads the file whenever it's modified, checks every interval until ctx is done
+func (w *watchedFile[T]) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(w.path)
+			if err != nil {
+				w.log.Error(fmt.Sprintf("cannot check %s %s: %s", w.name, w.path, err))
+				continue
+			}
+			if info.ModTime().UnixNano() == w.modTime.Load() {
+				continue
+			}
+			// a broken file is not retried until it's modified again
+			w.modTime.Store(info.ModTime().UnixNano())
+			if err := w.Reload(); err != nil {
+				w.log.Error(fmt.Sprintf("%s is not reloaded, keeping the previous one: %s", w.name, err))
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package scanning
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content encodings of scan messages, set in the AttrContentEncoding message attribute, messages without it aren't compressed
+const (
+	AttrContentEncoding = "content-encoding"
+	EncodingIdentity    = "identity"
+	EncodingGzip        = "gzip"
+	EncodingZstd        = "zstd"
+)
+
+// DefaultMaxPayload - default limit of the decompressed message size, responses above it wouldn't fit into the storage anyway
+const DefaultMaxPayload = 16 << 20
+
+var (
+	// ErrUnsupportedEncoding - the message is compressed with an unknown algorithm
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+	// ErrPayloadTooLarge - the message is larger than allowed once decompressed
+	ErrPayloadTooLarge = errors.New("payload is too large")
+)
+
+// zstdEncoder - EncodeAll is safe for concurrent use, NewWriter only fails on invalid options
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// Compress - compresses the encoded message, empty and EncodingIdentity encodings return the data as is
+func Compress(encoding string, data []byte) ([]byte, error) {
+	switch normalizeEncoding(encoding) {
+	case "", EncodingIdentity:
+		return data, nil
+	case EncodingGzip:
+		buf := &bytes.Buffer{}
+		zw := gzip.NewWriter(buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case EncodingZstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+// Decompress - decompresses the message, which must not exceed maxSize bytes once decompressed (DefaultMaxPayload if maxSize <= 0)
+// decompression stops with ErrPayloadTooLarge as soon as the limit is crossed,
+// so a tiny message inflating into gigabytes (decompression bomb) can't exhaust the memory
+func Decompress(encoding string, data []byte, maxSize int64) ([]byte, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxPayload
+	}
+	var r io.Reader
+	switch normalizeEncoding(encoding) {
+	case "", EncodingIdentity:
+		if int64(len(data)) > maxSize {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrPayloadTooLarge, maxSize)
+		}
+		return data, nil
+	case EncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s payload: %w", EncodingGzip, err)
+		}
+		defer func() { _ = zr.Close() }()
+		r = zr
+	case EncodingZstd:
+		// the memory limit also caps the window size a malicious frame header may ask for
+		zr, err := zstd.NewReader(bytes.NewReader(data),
+			zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true), zstd.WithDecoderMaxMemory(uint64(maxSize)))
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s payload: %w", EncodingZstd, err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+
+	res, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return nil, fmt.Errorf("%w: %w", ErrPayloadTooLarge, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("malformed %s payload: %w", normalizeEncoding(encoding), err)
+	}
+	if int64(len(res)) > maxSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrPayloadTooLarge, maxSize)
+	}
+	return res, nil
+}
+
+func normalizeEncoding(encoding string) string {
+	return strings.ToLower(strings.TrimSpace(encoding))
+}
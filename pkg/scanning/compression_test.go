@@ -0,0 +1,70 @@
+package scanning
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CompressionSuite struct {
+	suite.Suite
+}
+
+func TestCompressionSuite(t *testing.T) {
+	suite.Run(t, &CompressionSuite{})
+}
+
+func (s *CompressionSuite) TestRoundTrip() {
+	data := bytes.Repeat([]byte("HTTP/1.1 200 OK\r\nServer: nginx\r\n\r\n"), 1000)
+	for _, encoding := range []string{"", EncodingIdentity, EncodingGzip, EncodingZstd, " GZIP "} {
+		compressed, err := Compress(encoding, data)
+		s.Require().NoError(err, encoding)
+		if encoding == EncodingGzip || encoding == EncodingZstd {
+			s.Less(len(compressed), len(data)/10, encoding)
+		}
+		res, err := Decompress(encoding, compressed, 0)
+		s.NoError(err, encoding)
+		s.Equal(data, res, encoding)
+	}
+
+	_, err := Compress("br", data)
+	s.ErrorIs(err, ErrUnsupportedEncoding)
+	_, err = Decompress("br", data, 0)
+	s.ErrorIs(err, ErrUnsupportedEncoding)
+}
+
+func (s *CompressionSuite) TestLimits() {
+	const limit = 64 << 10
+	bomb := make([]byte, 4<<20)
+	for _, encoding := range []string{EncodingGzip, EncodingZstd} {
+		compressed, err := Compress(encoding, bomb)
+		s.Require().NoError(err)
+		// a few KB inflating into megabytes
+		s.Less(len(compressed), 64<<10, encoding)
+		_, err = Decompress(encoding, compressed, limit)
+		s.ErrorIs(err, ErrPayloadTooLarge, encoding)
+
+		// right at the limit is fine
+		compressed, err = Compress(encoding, bomb[:limit])
+		s.Require().NoError(err)
+		res, err := Decompress(encoding, compressed, limit)
+		s.NoError(err, encoding)
+		s.Len(res, limit)
+	}
+	_, err := Decompress("", bomb, limit)
+	s.ErrorIs(err, ErrPayloadTooLarge)
+}
+
+func (s *CompressionSuite) TestMalformed() {
+	for _, encoding := range []string{EncodingGzip, EncodingZstd} {
+		_, err := Decompress(encoding, []byte("not compressed at all"), 0)
+		s.Error(err, encoding)
+		s.NotErrorIs(err, ErrPayloadTooLarge, encoding)
+
+		compressed, err := Compress(encoding, bytes.Repeat([]byte("data"), 1000))
+		s.Require().NoError(err)
+		_, err = Decompress(encoding, compressed[:len(compressed)/2], 0)
+		s.Error(err, encoding)
+	}
+}
@@ -0,0 +1,546 @@
+// Protobuf wire format of scan messages, the Go types are generated into scanpb (see go:generate in wire.go)
+// and mapped to scanning.Scan by wire.go, field numbers are part of the wire format - never reuse or renumber them
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: scan.proto
+
+package scanpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Scan struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Ip        string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Port      uint32                 `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	Service   string                 `protobuf:"bytes,3,opt,name=service,proto3" json:"service,omitempty"`
+	Timestamp int64                  `protobuf:"varint,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// data version is the data field which is set
+	//
+	// Types that are valid to be assigned to Data:
+	//
+	//	*Scan_V1
+	//	*Scan_V2
+	//	*Scan_V3
+	Data          isScan_Data `protobuf_oneof:"data"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Scan) Reset() {
+	*x = Scan{}
+	mi := &file_scan_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Scan) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Scan) ProtoMessage() {}
+
+func (x *Scan) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Scan.ProtoReflect.Descriptor instead.
+func (*Scan) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Scan) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *Scan) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *Scan) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *Scan) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *Scan) GetData() isScan_Data {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *Scan) GetV1() *V1Data {
+	if x != nil {
+		if x, ok := x.Data.(*Scan_V1); ok {
+			return x.V1
+		}
+	}
+	return nil
+}
+
+func (x *Scan) GetV2() *V2Data {
+	if x != nil {
+		if x, ok := x.Data.(*Scan_V2); ok {
+			return x.V2
+		}
+	}
+	return nil
+}
+
+func (x *Scan) GetV3() *V3Data {
+	if x != nil {
+		if x, ok := x.Data.(*Scan_V3); ok {
+			return x.V3
+		}
+	}
+	return nil
+}
+
+type isScan_Data interface {
+	isScan_Data()
+}
+
+type Scan_V1 struct {
+	V1 *V1Data `protobuf:"bytes,5,opt,name=v1,proto3,oneof"`
+}
+
+type Scan_V2 struct {
+	V2 *V2Data `protobuf:"bytes,6,opt,name=v2,proto3,oneof"`
+}
+
+type Scan_V3 struct {
+	V3 *V3Data `protobuf:"bytes,7,opt,name=v3,proto3,oneof"`
+}
+
+func (*Scan_V1) isScan_Data() {}
+
+func (*Scan_V2) isScan_Data() {}
+
+func (*Scan_V3) isScan_Data() {}
+
+type V1Data struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	ResponseBytesUtf8 []byte                 `protobuf:"bytes,1,opt,name=response_bytes_utf8,json=responseBytesUtf8,proto3" json:"response_bytes_utf8,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *V1Data) Reset() {
+	*x = V1Data{}
+	mi := &file_scan_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *V1Data) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*V1Data) ProtoMessage() {}
+
+func (x *V1Data) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use V1Data.ProtoReflect.Descriptor instead.
+func (*V1Data) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *V1Data) GetResponseBytesUtf8() []byte {
+	if x != nil {
+		return x.ResponseBytesUtf8
+	}
+	return nil
+}
+
+type V2Data struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ResponseStr   string                 `protobuf:"bytes,1,opt,name=response_str,json=responseStr,proto3" json:"response_str,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *V2Data) Reset() {
+	*x = V2Data{}
+	mi := &file_scan_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *V2Data) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*V2Data) ProtoMessage() {}
+
+func (x *V2Data) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use V2Data.ProtoReflect.Descriptor instead.
+func (*V2Data) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *V2Data) GetResponseStr() string {
+	if x != nil {
+		return x.ResponseStr
+	}
+	return ""
+}
+
+type V3Data struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Response []byte                 `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	// "tcp" or "udp"
+	Transport string   `protobuf:"bytes,2,opt,name=transport,proto3" json:"transport,omitempty"`
+	Request   []byte   `protobuf:"bytes,3,opt,name=request,proto3" json:"request,omitempty"`
+	Truncated bool     `protobuf:"varint,4,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	LatencyUs int64    `protobuf:"varint,5,opt,name=latency_us,json=latencyUs,proto3" json:"latency_us,omitempty"`
+	Tls       *TLSInfo `protobuf:"bytes,6,opt,name=tls,proto3" json:"tls,omitempty"`
+	// protocol specific sections keyed by protocol, every section is a JSON document
+	Sections      map[string][]byte `protobuf:"bytes,7,rep,name=sections,proto3" json:"sections,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *V3Data) Reset() {
+	*x = V3Data{}
+	mi := &file_scan_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *V3Data) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*V3Data) ProtoMessage() {}
+
+func (x *V3Data) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use V3Data.ProtoReflect.Descriptor instead.
+func (*V3Data) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *V3Data) GetResponse() []byte {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+func (x *V3Data) GetTransport() string {
+	if x != nil {
+		return x.Transport
+	}
+	return ""
+}
+
+func (x *V3Data) GetRequest() []byte {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+func (x *V3Data) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *V3Data) GetLatencyUs() int64 {
+	if x != nil {
+		return x.LatencyUs
+	}
+	return 0
+}
+
+func (x *V3Data) GetTls() *TLSInfo {
+	if x != nil {
+		return x.Tls
+	}
+	return nil
+}
+
+func (x *V3Data) GetSections() map[string][]byte {
+	if x != nil {
+		return x.Sections
+	}
+	return nil
+}
+
+type TLSInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	CipherSuite   string                 `protobuf:"bytes,2,opt,name=cipher_suite,json=cipherSuite,proto3" json:"cipher_suite,omitempty"`
+	ServerName    string                 `protobuf:"bytes,3,opt,name=server_name,json=serverName,proto3" json:"server_name,omitempty"`
+	Alpn          string                 `protobuf:"bytes,4,opt,name=alpn,proto3" json:"alpn,omitempty"`
+	CertSha256    string                 `protobuf:"bytes,5,opt,name=cert_sha256,json=certSha256,proto3" json:"cert_sha256,omitempty"`
+	CertSubject   string                 `protobuf:"bytes,6,opt,name=cert_subject,json=certSubject,proto3" json:"cert_subject,omitempty"`
+	CertIssuer    string                 `protobuf:"bytes,7,opt,name=cert_issuer,json=certIssuer,proto3" json:"cert_issuer,omitempty"`
+	CertNotAfter  int64                  `protobuf:"varint,8,opt,name=cert_not_after,json=certNotAfter,proto3" json:"cert_not_after,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TLSInfo) Reset() {
+	*x = TLSInfo{}
+	mi := &file_scan_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TLSInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TLSInfo) ProtoMessage() {}
+
+func (x *TLSInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_scan_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TLSInfo.ProtoReflect.Descriptor instead.
+func (*TLSInfo) Descriptor() ([]byte, []int) {
+	return file_scan_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TLSInfo) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetCipherSuite() string {
+	if x != nil {
+		return x.CipherSuite
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetServerName() string {
+	if x != nil {
+		return x.ServerName
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetAlpn() string {
+	if x != nil {
+		return x.Alpn
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetCertSha256() string {
+	if x != nil {
+		return x.CertSha256
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetCertSubject() string {
+	if x != nil {
+		return x.CertSubject
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetCertIssuer() string {
+	if x != nil {
+		return x.CertIssuer
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetCertNotAfter() int64 {
+	if x != nil {
+		return x.CertNotAfter
+	}
+	return 0
+}
+
+var File_scan_proto protoreflect.FileDescriptor
+
+const file_scan_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"scan.proto\x12\bscanning\"\xd6\x01\n" +
+	"\x04Scan\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\rR\x04port\x12\x18\n" +
+	"\aservice\x18\x03 \x01(\tR\aservice\x12\x1c\n" +
+	"\ttimestamp\x18\x04 \x01(\x03R\ttimestamp\x12\"\n" +
+	"\x02v1\x18\x05 \x01(\v2\x10.scanning.V1DataH\x00R\x02v1\x12\"\n" +
+	"\x02v2\x18\x06 \x01(\v2\x10.scanning.V2DataH\x00R\x02v2\x12\"\n" +
+	"\x02v3\x18\a \x01(\v2\x10.scanning.V3DataH\x00R\x02v3B\x06\n" +
+	"\x04data\"8\n" +
+	"\x06V1Data\x12.\n" +
+	"\x13response_bytes_utf8\x18\x01 \x01(\fR\x11responseBytesUtf8\"+\n" +
+	"\x06V2Data\x12!\n" +
+	"\fresponse_str\x18\x01 \x01(\tR\vresponseStr\"\xb7\x02\n" +
+	"\x06V3Data\x12\x1a\n" +
+	"\bresponse\x18\x01 \x01(\fR\bresponse\x12\x1c\n" +
+	"\ttransport\x18\x02 \x01(\tR\ttransport\x12\x18\n" +
+	"\arequest\x18\x03 \x01(\fR\arequest\x12\x1c\n" +
+	"\ttruncated\x18\x04 \x01(\bR\ttruncated\x12\x1d\n" +
+	"\n" +
+	"latency_us\x18\x05 \x01(\x03R\tlatencyUs\x12#\n" +
+	"\x03tls\x18\x06 \x01(\v2\x11.scanning.TLSInfoR\x03tls\x12:\n" +
+	"\bsections\x18\a \x03(\v2\x1e.scanning.V3Data.SectionsEntryR\bsections\x1a;\n" +
+	"\rSectionsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value:\x028\x01\"\x86\x02\n" +
+	"\aTLSInfo\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x12!\n" +
+	"\fcipher_suite\x18\x02 \x01(\tR\vcipherSuite\x12\x1f\n" +
+	"\vserver_name\x18\x03 \x01(\tR\n" +
+	"serverName\x12\x12\n" +
+	"\x04alpn\x18\x04 \x01(\tR\x04alpn\x12\x1f\n" +
+	"\vcert_sha256\x18\x05 \x01(\tR\n" +
+	"certSha256\x12!\n" +
+	"\fcert_subject\x18\x06 \x01(\tR\vcertSubject\x12\x1f\n" +
+	"\vcert_issuer\x18\a \x01(\tR\n" +
+	"certIssuer\x12$\n" +
+	"\x0ecert_not_after\x18\b \x01(\x03R\fcertNotAfterB6Z4github.com/igorvan/scan-takehome/pkg/scanning/scanpbb\x06proto3"
+
+var (
+	file_scan_proto_rawDescOnce sync.Once
+	file_scan_proto_rawDescData []byte
+)
+
+func file_scan_proto_rawDescGZIP() []byte {
+	file_scan_proto_rawDescOnce.Do(func() {
+		file_scan_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_scan_proto_rawDesc), len(file_scan_proto_rawDesc)))
+	})
+	return file_scan_proto_rawDescData
+}
+
+var file_scan_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_scan_proto_goTypes = []any{
+	(*Scan)(nil),    // 0: scanning.Scan
+	(*V1Data)(nil),  // 1: scanning.V1Data
+	(*V2Data)(nil),  // 2: scanning.V2Data
+	(*V3Data)(nil),  // 3: scanning.V3Data
+	(*TLSInfo)(nil), // 4: scanning.TLSInfo
+	nil,             // 5: scanning.V3Data.SectionsEntry
+}
+var file_scan_proto_depIdxs = []int32{
+	1, // 0: scanning.Scan.v1:type_name -> scanning.V1Data
+	2, // 1: scanning.Scan.v2:type_name -> scanning.V2Data
+	3, // 2: scanning.Scan.v3:type_name -> scanning.V3Data
+	4, // 3: scanning.V3Data.tls:type_name -> scanning.TLSInfo
+	5, // 4: scanning.V3Data.sections:type_name -> scanning.V3Data.SectionsEntry
+	5, // [5:5] is the sub-list for method output_type
+	5, // [5:5] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_scan_proto_init() }
+func file_scan_proto_init() {
+	if File_scan_proto != nil {
+		return
+	}
+	file_scan_proto_msgTypes[0].OneofWrappers = []any{
+		(*Scan_V1)(nil),
+		(*Scan_V2)(nil),
+		(*Scan_V3)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_scan_proto_rawDesc), len(file_scan_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_scan_proto_goTypes,
+		DependencyIndexes: file_scan_proto_depIdxs,
+		MessageInfos:      file_scan_proto_msgTypes,
+	}.Build()
+	File_scan_proto = out.File
+	file_scan_proto_goTypes = nil
+	file_scan_proto_depIdxs = nil
+}
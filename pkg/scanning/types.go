@@ -1,18 +1,51 @@
 package scanning
 
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+)
+
+// Data versions, the only source of truth for both the scanner and the processing side
 const (
 	Version = iota
+	// V1 - older - base64 encoded string
 	V1
+	// V2 - newer - decoded string
 	V2
+	// V3 - structured - raw response bytes along with the details of the exchange
+	V3
+)
+
+// Transports
+const (
+	TransportTCP = "tcp"
+	TransportUDP = "udp"
 )
 
 type Scan struct {
-	Ip          string      `json:"ip"`
-	Port        uint32      `json:"port"`
-	Service     string      `json:"service"`
-	Timestamp   int64       `json:"timestamp"`
-	DataVersion int         `json:"data_version"`
-	Data        interface{} `json:"data"`
+	Ip          string `json:"ip"`
+	Port        uint32 `json:"port"`
+	Service     string `json:"service"`
+	Timestamp   int64  `json:"timestamp"`
+	DataVersion int    `json:"data_version"`
+	// Data - version specific data, kept raw until the decoder of DataVersion takes over, nil if Decoded is set
+	Data json.RawMessage `json:"data"`
+	// Decoded - version specific data decoded by the wire format (*V1Data, *V2Data or *V3Data of protobuf messages),
+	// so it isn't encoded into JSON just to be decoded again, nil for JSON messages
+	Decoded any `json:"-"`
+}
+
+// SetData - sets the data along with its version
+func (s *Scan) SetData(version int, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	s.DataVersion = version
+	s.Data = b
+	s.Decoded = nil
+	return nil
 }
 
 type V1Data struct {
@@ -22,3 +55,56 @@ type V1Data struct {
 type V2Data struct {
 	ResponseStr string `json:"response_str"`
 }
+
+// V3Data - structured scan data
+type V3Data struct {
+	// Response - raw response bytes, base64 encoded in JSON
+	Response []byte `json:"response"`
+	Details
+}
+
+// Details - details of the scanner's exchange with the service, everything but the response itself
+type Details struct {
+	// Transport - TransportTCP or TransportUDP
+	Transport string `json:"transport"`
+	// Request - raw bytes sent to the service, if any
+	Request []byte `json:"request,omitempty"`
+	// Truncated - the scanner stopped reading before the service finished responding
+	Truncated bool `json:"truncated,omitempty"`
+	// LatencyMicros - time from the request (or connection) to the first response byte
+	LatencyMicros int64 `json:"latency_us,omitempty"`
+	// TLS - handshake details, nil for plaintext exchanges
+	TLS *TLSInfo `json:"tls,omitempty"`
+	// Sections - protocol specific details keyed by protocol (e.g. "http"), opaque to the processing side
+	Sections map[string]json.RawMessage `json:"sections,omitempty"`
+}
+
+// Clone - deep copy of the details, nil for nil
+func (d *Details) Clone() *Details {
+	if d == nil {
+		return nil
+	}
+	cp := *d
+	cp.Request = bytes.Clone(d.Request)
+	if d.TLS != nil {
+		tls := *d.TLS
+		cp.TLS = &tls
+	}
+	cp.Sections = maps.Clone(d.Sections)
+	return &cp
+}
+
+// TLSInfo - TLS handshake details
+type TLSInfo struct {
+	// Version - negotiated protocol version, e.g. "TLS 1.3"
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
+	ServerName  string `json:"server_name,omitempty"`
+	ALPN        string `json:"alpn,omitempty"`
+	// CertSHA256 - hex SHA-256 fingerprint of the leaf certificate
+	CertSHA256  string `json:"cert_sha256,omitempty"`
+	CertSubject string `json:"cert_subject,omitempty"`
+	CertIssuer  string `json:"cert_issuer,omitempty"`
+	// CertNotAfter - leaf certificate expiration, unix seconds
+	CertNotAfter int64 `json:"cert_not_after,omitempty"`
+}
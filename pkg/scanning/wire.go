@@ -0,0 +1,209 @@
+package scanning
+
+//go:generate protoc --go_out=scanpb --go_opt=paths=source_relative scan.proto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/igorvan/scan-takehome/pkg/scanning/scanpb"
+)
+
+// Wire formats of scan messages, selected by the AttrContentType message attribute
+const (
+	// AttrContentType - message attribute with the wire format of the message, messages without it are JSON
+	AttrContentType     = "content-type"
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// ErrUnsupportedContentType - the message is in an unknown wire format
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// Marshal - encodes the scan in the wire format of the content type
+func Marshal(contentType string, scan *Scan) ([]byte, error) {
+	switch mediaType(contentType) {
+	case ContentTypeJSON:
+		if scan.Decoded != nil {
+			data, err := scan.jsonData()
+			if err != nil {
+				return nil, err
+			}
+			cp := *scan
+			cp.Data = data
+			scan = &cp
+		}
+		return json.Marshal(scan)
+	case ContentTypeProtobuf:
+		return scan.MarshalProto()
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedContentType, contentType)
+	}
+}
+
+// Unmarshal - decodes the scan from the wire format of the content type, empty content type means JSON
+func Unmarshal(contentType string, data []byte, scan *Scan) error {
+	switch mediaType(contentType) {
+	case "", ContentTypeJSON:
+		return json.Unmarshal(data, scan)
+	case ContentTypeProtobuf:
+		return scan.UnmarshalProto(data)
+	default:
+		return fmt.Errorf("%w %q", ErrUnsupportedContentType, contentType)
+	}
+}
+
+// mediaType - content type without parameters, lower-cased, "application/protobuf" is an alias of ContentTypeProtobuf
+func mediaType(contentType string) string {
+	mt, _, _ := strings.Cut(contentType, ";")
+	mt = strings.ToLower(strings.TrimSpace(mt))
+	if mt == "application/protobuf" {
+		return ContentTypeProtobuf
+	}
+	return mt
+}
+
+// MarshalProto - protobuf encoding of the scan, the data is either Decoded or valid JSON of its data version
+func (s *Scan) MarshalProto() ([]byte, error) {
+	msg := &scanpb.Scan{Ip: s.Ip, Port: s.Port, Service: s.Service, Timestamp: s.Timestamp}
+	data, err := s.typedData()
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode data version %d: %w", s.DataVersion, err)
+	}
+	// the oneof field is written even if the data message is empty, that's what tells the version
+	switch d := data.(type) {
+	case *V1Data:
+		msg.Data = &scanpb.Scan_V1{V1: &scanpb.V1Data{ResponseBytesUtf8: d.ResponseBytesUtf8}}
+	case *V2Data:
+		msg.Data = &scanpb.Scan_V2{V2: &scanpb.V2Data{ResponseStr: d.ResponseStr}}
+	case *V3Data:
+		msg.Data = &scanpb.Scan_V3{V3: d.proto()}
+	default:
+		return nil, fmt.Errorf("cannot encode data version %d: unexpected data %T", s.DataVersion, data)
+	}
+	// deterministic, so the same scan is always encoded the same way
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+// UnmarshalProto - decodes protobuf encoded scan, the data is kept in Decoded as *V1Data, *V2Data or *V3Data
+// unknown fields are skipped, so newer scanners can add fields without breaking older processors
+func (s *Scan) UnmarshalProto(b []byte) error {
+	msg := &scanpb.Scan{}
+	if err := proto.Unmarshal(b, msg); err != nil {
+		return err
+	}
+	*s = Scan{Ip: msg.GetIp(), Port: msg.GetPort(), Service: msg.GetService(), Timestamp: msg.GetTimestamp()}
+	switch data := msg.GetData().(type) {
+	case *scanpb.Scan_V1:
+		s.DataVersion, s.Decoded = V1, &V1Data{ResponseBytesUtf8: data.V1.GetResponseBytesUtf8()}
+	case *scanpb.Scan_V2:
+		s.DataVersion, s.Decoded = V2, &V2Data{ResponseStr: data.V2.GetResponseStr()}
+	case *scanpb.Scan_V3:
+		v3Data, err := v3DataOf(data.V3)
+		if err != nil {
+			return err
+		}
+		s.DataVersion, s.Decoded = V3, v3Data
+	default:
+		return errors.New("scan has no data")
+	}
+	return nil
+}
+
+// typedData - the data as *V1Data, *V2Data or *V3Data
+func (s *Scan) typedData() (any, error) {
+	if s.Decoded != nil {
+		return s.Decoded, nil
+	}
+	var data any
+	switch s.DataVersion {
+	case V1:
+		data = &V1Data{}
+	case V2:
+		data = &V2Data{}
+	case V3:
+		data = &V3Data{}
+	default:
+		return nil, fmt.Errorf("data version %d has no protobuf representation", s.DataVersion)
+	}
+	if err := json.Unmarshal(s.Data, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// jsonData - the data as JSON of its data version
+func (s *Scan) jsonData() (json.RawMessage, error) {
+	if s.Decoded == nil {
+		return s.Data, nil
+	}
+	return json.Marshal(s.Decoded)
+}
+
+func (d *V3Data) proto() *scanpb.V3Data {
+	msg := &scanpb.V3Data{
+		Response:  d.Response,
+		Transport: d.Transport,
+		Request:   d.Request,
+		Truncated: d.Truncated,
+		LatencyUs: d.LatencyMicros,
+	}
+	if d.TLS != nil {
+		msg.Tls = &scanpb.TLSInfo{
+			Version:      d.TLS.Version,
+			CipherSuite:  d.TLS.CipherSuite,
+			ServerName:   d.TLS.ServerName,
+			Alpn:         d.TLS.ALPN,
+			CertSha256:   d.TLS.CertSHA256,
+			CertSubject:  d.TLS.CertSubject,
+			CertIssuer:   d.TLS.CertIssuer,
+			CertNotAfter: d.TLS.CertNotAfter,
+		}
+	}
+	if len(d.Sections) > 0 {
+		msg.Sections = make(map[string][]byte, len(d.Sections))
+		for k, v := range d.Sections {
+			msg.Sections[k] = v
+		}
+	}
+	return msg
+}
+
+// v3DataOf - V3Data of the protobuf message, sections must be valid JSON
+func v3DataOf(msg *scanpb.V3Data) (*V3Data, error) {
+	d := &V3Data{
+		Response: msg.GetResponse(),
+		Details: Details{
+			Transport:     msg.GetTransport(),
+			Request:       msg.GetRequest(),
+			Truncated:     msg.GetTruncated(),
+			LatencyMicros: msg.GetLatencyUs(),
+		},
+	}
+	if tls := msg.GetTls(); tls != nil {
+		d.TLS = &TLSInfo{
+			Version:      tls.GetVersion(),
+			CipherSuite:  tls.GetCipherSuite(),
+			ServerName:   tls.GetServerName(),
+			ALPN:         tls.GetAlpn(),
+			CertSHA256:   tls.GetCertSha256(),
+			CertSubject:  tls.GetCertSubject(),
+			CertIssuer:   tls.GetCertIssuer(),
+			CertNotAfter: tls.GetCertNotAfter(),
+		}
+	}
+	for k, v := range msg.GetSections() {
+		if !json.Valid(v) {
+			return nil, fmt.Errorf("section %q is not valid JSON", k)
+		}
+		if d.Sections == nil {
+			d.Sections = map[string]json.RawMessage{}
+		}
+		d.Sections[k] = v
+	}
+	return d, nil
+}
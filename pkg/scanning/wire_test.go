@@ -0,0 +1,119 @@
+package scanning
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WireSuite struct {
+	suite.Suite
+}
+
+func TestWireSuite(t *testing.T) {
+	suite.Run(t, &WireSuite{})
+}
+
+func (s *WireSuite) scan(version int, data any) *Scan {
+	scan := &Scan{Ip: "1.1.1.1", Port: 443, Service: "HTTP", Timestamp: 1700000000}
+	s.Require().NoError(scan.SetData(version, data))
+	return scan
+}
+
+func (s *WireSuite) TestRoundTrip() {
+	scans := []*Scan{
+		s.scan(V1, V1Data{ResponseBytesUtf8: []byte("caf\xe9\x00\xff")}),
+		s.scan(V2, V2Data{ResponseStr: "HTTP/1.1 200 OK\r\n\r\n"}),
+		s.scan(V2, V2Data{}),
+		s.scan(V3, V3Data{
+			Response: []byte("HTTP/1.1 200 OK\r\n\r\n"),
+			Details: Details{
+				Transport:     TransportTCP,
+				Request:       []byte("GET / HTTP/1.1\r\n\r\n"),
+				Truncated:     true,
+				LatencyMicros: 2500,
+				TLS: &TLSInfo{Version: "TLS 1.3", CipherSuite: "TLS_AES_128_GCM_SHA256", ServerName: "example.com", ALPN: "h2",
+					CertSHA256: "ab12", CertSubject: "CN=example.com", CertIssuer: "CN=Example CA", CertNotAfter: 1800000000},
+				Sections: map[string]json.RawMessage{"http": json.RawMessage(`{"redirects":1}`), "tls": json.RawMessage(`[]`)},
+			},
+		}),
+		s.scan(V3, V3Data{Response: []byte{0x12, 0x34}, Details: Details{Transport: TransportUDP}}),
+	}
+	for _, contentType := range []string{ContentTypeJSON, ContentTypeProtobuf} {
+		for _, scan := range scans {
+			b, err := Marshal(contentType, scan)
+			s.Require().NoError(err)
+			res := &Scan{}
+			s.Require().NoError(Unmarshal(contentType, b, res))
+			s.Equal(scan.Ip, res.Ip)
+			s.Equal(scan.Port, res.Port)
+			s.Equal(scan.Service, res.Service)
+			s.Equal(scan.Timestamp, res.Timestamp)
+			s.Equal(scan.DataVersion, res.DataVersion)
+			data, err := res.jsonData()
+			s.Require().NoError(err)
+			s.JSONEq(string(scan.Data), string(data), contentType)
+
+			// scans received as protobuf are encoded the same way again
+			b2, err := Marshal(contentType, res)
+			s.Require().NoError(err)
+			s.Equal(string(b), string(b2), contentType)
+		}
+	}
+}
+
+func (s *WireSuite) TestProtoEncoding() {
+	// encoded by hand following scan.proto, so the mapping of Scan to the generated types can't drift unnoticed
+	golden := []byte{
+		0x0a, 0x07, '1', '.', '1', '.', '1', '.', '1', // ip
+		0x10, 0x50, // port
+		0x1a, 0x04, 'H', 'T', 'T', 'P', // service
+		0x20, 0x64, // timestamp
+		0x32, 0x04, 0x0a, 0x02, 'h', 'i', // v2 { response_str }
+	}
+	scan := &Scan{Ip: "1.1.1.1", Port: 80, Service: "HTTP", Timestamp: 100}
+	s.Require().NoError(scan.SetData(V2, V2Data{ResponseStr: "hi"}))
+	b, err := scan.MarshalProto()
+	s.NoError(err)
+	s.Equal(golden, b)
+
+	// unknown fields are skipped
+	res := &Scan{}
+	s.NoError(res.UnmarshalProto(append([]byte{0x78, 0x01, 0x82, 0x01, 0x01, 'x'}, golden...)))
+	s.Equal(V2, res.DataVersion)
+	// the data isn't converted into JSON
+	s.Nil(res.Data)
+	s.Equal(&V2Data{ResponseStr: "hi"}, res.Decoded)
+	s.Equal("1.1.1.1", res.Ip)
+}
+
+func (s *WireSuite) TestErrors() {
+	_, err := Marshal("text/plain", s.scan(V2, V2Data{ResponseStr: "hi"}))
+	s.ErrorIs(err, ErrUnsupportedContentType)
+	s.ErrorIs(Unmarshal("text/xml", []byte("<scan/>"), &Scan{}), ErrUnsupportedContentType)
+
+	// older scanners send no content type
+	res := &Scan{}
+	s.NoError(Unmarshal("", []byte(`{"ip":"1.1.1.1","data_version":2,"data":{"response_str":"hi"}}`), res))
+	s.Equal("1.1.1.1", res.Ip)
+	// parameters and aliases
+	b, err := Marshal("application/protobuf", s.scan(V2, V2Data{ResponseStr: "hi"}))
+	s.NoError(err)
+	s.NoError(Unmarshal("Application/X-Protobuf; proto=scanning.Scan", b, res))
+
+	_, err = (&Scan{DataVersion: 42, Data: json.RawMessage(`{}`)}).MarshalProto()
+	s.Error(err)
+	_, err = (&Scan{DataVersion: V2, Data: json.RawMessage(`{"response_str":42}`)}).MarshalProto()
+	s.Error(err)
+
+	for name, b := range map[string][]byte{
+		"no data":          {0x0a, 0x01, 'x'},
+		"truncated":        {0x0a, 0x07, '1'},
+		"broken tag":       {0xff},
+		"broken data":      {0x32, 0x02, 0x0a, 0x05},
+		"bad section JSON": {0x3a, 0x09, 0x3a, 0x07, 0x0a, 0x01, 'x', 0x12, 0x02, '{', '{'},
+	} {
+		s.Error((&Scan{}).UnmarshalProto(b), name)
+	}
+}